@@ -50,6 +50,13 @@ func loadCredentials() (*Credentials, error) {
 	return creds, nil
 }
 
+// OAuth scopes. Writing values ('serve' PUT requests) needs the full scope,
+// which 'auth login --write' asks for.
+const (
+	scopeReadOnly = "https://www.googleapis.com/auth/spreadsheets.readonly"
+	scopeWrite    = "https://www.googleapis.com/auth/spreadsheets"
+)
+
 // OAuthManager handles OAuth 2.0 authentication flow
 type OAuthManager struct {
 	config *oauth2.Config
@@ -69,7 +76,7 @@ func NewOAuthManager() (*OAuthManager, error) {
 			AuthURL:  google.Endpoint.AuthURL,
 			TokenURL: google.Endpoint.TokenURL,
 		},
-		Scopes:      []string{"https://www.googleapis.com/auth/spreadsheets.readonly"},
+		Scopes:      []string{scopeReadOnly},
 		RedirectURL: "urn:ietf:wg:oauth:2.0:oob",
 	}
 	config.Endpoint.AuthStyle = oauth2.AuthStyleInParams
@@ -97,6 +104,22 @@ func (om *OAuthManager) GetAuthenticatedClient() (*http.Client, error) {
 	return om.config.Client(context.Background(), tok), nil
 }
 
+// LoginWithWriteAccess runs the OAuth flow asking for write access and
+// replaces the stored token.
+func (om *OAuthManager) LoginWithWriteAccess() error {
+	om.config.Scopes = []string{scopeWrite}
+	tok, err := om.getTokenFromWeb()
+	if err != nil {
+		return fmt.Errorf("failed to get token from web: %w", err)
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return fmt.Errorf("unable to get current user: %w", err)
+	}
+	om.saveToken(filepath.Join(usr.HomeDir, ".cell-clip", "token.json"), tok)
+	return nil
+}
+
 // getTokenFromWeb implements the OAuth 2.0 PKCE flow.
 func (om *OAuthManager) getTokenFromWeb() (*oauth2.Token, error) {
 	// Use out-of-band redirect (no local server) because the sandbox
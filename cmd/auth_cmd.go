@@ -20,6 +20,8 @@ var authCmd = &cobra.Command{
 		"This command provides subcommands to authenticate, logout, and setup credentials.",
 }
 
+var loginWrite bool
+
 var loginCmd = &cobra.Command{
 	Use:   "login",
 	Short: "Authenticate with Google Sheets",
@@ -33,7 +35,9 @@ var loginCmd = &cobra.Command{
 		"  \"client_secret\": \"YOUR_CLIENT_SECRET\"\n" +
 		"}\n\n" +
 		"You can create this file manually or use the 'cell-clip auth setup' command.\n\n" +
-		"After creating the file, run this command to start the authentication process.",
+		"After creating the file, run this command to start the authentication process.\n\n" +
+		"--write asks for access to edit spreadsheets as well, which writing values\n" +
+		"through 'cell-clip serve' needs. It always starts a new authorization.",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Starting Google Sheets authentication...")
 
@@ -42,7 +46,11 @@ var loginCmd = &cobra.Command{
 			log.Fatalf("Unable to initialize OAuth manager: %v", err)
 		}
 
-		_, err = oauthManager.GetAuthenticatedClient()
+		if loginWrite {
+			err = oauthManager.LoginWithWriteAccess()
+		} else {
+			_, err = oauthManager.GetAuthenticatedClient()
+		}
 		if err != nil {
 			log.Fatalf("Authentication failed: %v", err)
 		}
@@ -136,6 +144,7 @@ var setupCmd = &cobra.Command{
 }
 
 func init() {
+	loginCmd.Flags().BoolVar(&loginWrite, "write", false, "Also allow writing values to spreadsheets")
 	authCmd.AddCommand(loginCmd)
 	authCmd.AddCommand(logoutCmd)
 	authCmd.AddCommand(setupCmd)
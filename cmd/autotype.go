@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Defaults for typing values, see --type-delay and --countdown.
+var (
+	typeDelay     = 12 * time.Millisecond
+	typeCountdown = 3 * time.Second
+)
+
+// typeSink types values into the focused window with xdotool (X11) or wtype
+// (Wayland), for applications that block pasting.
+type typeSink struct {
+	delay     time.Duration
+	countdown time.Duration
+	wayland   bool
+	run       commandRunner
+	// out receives the countdown, sleep waits between its steps.
+	out   io.Writer
+	sleep func(time.Duration)
+}
+
+// newTypeSink returns a typeSink for the running display server.
+func newTypeSink() typeSink {
+	return typeSink{
+		delay:     typeDelay,
+		countdown: typeCountdown,
+		wayland:   os.Getenv("WAYLAND_DISPLAY") != "",
+		run:       execCommand,
+		out:       os.Stderr,
+		sleep:     time.Sleep,
+	}
+}
+
+// Write counts down so that the user can focus the target window, then
+// types text. The text is passed on stdin rather than as an argument, so it
+// does not show up in the process list.
+func (s typeSink) Write(text string) error {
+	for left := s.countdown; left > 0; left -= time.Second {
+		fmt.Fprintf(s.out, "\rTyping in %d... ", int((left+time.Second-1)/time.Second))
+		s.sleep(min(left, time.Second))
+	}
+	if s.countdown > 0 {
+		fmt.Fprint(s.out, "\r\x1b[K")
+	}
+	_, err := s.run(s.command(), text)
+	return err
+}
+
+// command returns the typing command.
+func (s typeSink) command() []string {
+	ms := strconv.FormatInt(s.delay.Milliseconds(), 10)
+	if s.wayland {
+		return []string{"wtype", "-d", ms, "-"}
+	}
+	return []string{"xdotool", "type", "--delay", ms, "--file", "-"}
+}
+
+func (typeSink) Read() (string, error) { return "", errCannotRead }
+func (typeSink) Target() string        { return "focused window" }
+func (typeSink) Spec() string          { return clipboardType }
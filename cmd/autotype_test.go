@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeRunner records the commands run by a sink.
+type fakeRunner struct {
+	argv  [][]string
+	stdin []string
+	out   string
+}
+
+func (f *fakeRunner) run(argv []string, stdin string) (string, error) {
+	f.argv = append(f.argv, argv)
+	f.stdin = append(f.stdin, stdin)
+	return f.out, nil
+}
+
+func TestTypeSinkWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		wayland bool
+		want    []string
+	}{
+		{name: "X11", want: []string{"xdotool", "type", "--delay", "25", "--file", "-"}},
+		{name: "Wayland", wayland: true, want: []string{"wtype", "-d", "25", "-"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r fakeRunner
+			var out bytes.Buffer
+			var slept []time.Duration
+			s := typeSink{
+				delay:     25 * time.Millisecond,
+				countdown: 2500 * time.Millisecond,
+				wayland:   tt.wayland,
+				run:       r.run,
+				out:       &out,
+				sleep:     func(d time.Duration) { slept = append(slept, d) },
+			}
+			if err := s.Write("p@ss word"); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			if len(r.argv) != 1 {
+				t.Fatalf("ran %d command(s), want 1", len(r.argv))
+			}
+			if !reflect.DeepEqual(r.argv[0], tt.want) {
+				t.Errorf("argv = %q, want %q", r.argv[0], tt.want)
+			}
+			// 値はコマンドライン引数ではなく stdin で渡す
+			if r.stdin[0] != "p@ss word" {
+				t.Errorf("stdin = %q, want %q", r.stdin[0], "p@ss word")
+			}
+			for _, arg := range r.argv[0] {
+				if arg == "p@ss word" {
+					t.Errorf("the text was passed as an argument: %q", r.argv[0])
+				}
+			}
+
+			wantOut := "\rTyping in 3... \rTyping in 2... \rTyping in 1... \r\x1b[K"
+			if out.String() != wantOut {
+				t.Errorf("countdown = %q, want %q", out.String(), wantOut)
+			}
+			wantSlept := []time.Duration{time.Second, time.Second, 500 * time.Millisecond}
+			if !reflect.DeepEqual(slept, wantSlept) {
+				t.Errorf("slept %v, want %v", slept, wantSlept)
+			}
+		})
+	}
+}
+
+func TestTypeSinkNoCountdown(t *testing.T) {
+	var r fakeRunner
+	var out bytes.Buffer
+	s := typeSink{
+		delay: 0,
+		run:   r.run,
+		out:   &out,
+		sleep: func(time.Duration) { t.Error("slept without a countdown") },
+	}
+	if err := s.Write("x"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("output = %q, want none", out.String())
+	}
+	want := []string{"xdotool", "type", "--delay", "0", "--file", "-"}
+	if len(r.argv) != 1 || !reflect.DeepEqual(r.argv[0], want) {
+		t.Errorf("argv = %q, want %q", r.argv, want)
+	}
+}
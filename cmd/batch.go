@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// getResult is the outcome of fetching one setting.
+type getResult struct {
+	Name string `json:"name"`
+	// Value keeps the type returned by the API, so that numbers stay
+	// numbers in JSON. Text is the value as copied or printed.
+	Value interface{} `json:"value"`
+	Text  string      `json:"-"`
+	Found bool        `json:"found"`
+	Error string      `json:"error,omitempty"`
+	// Sensitive results are masked in the output.
+	Sensitive bool `json:"-"`
+}
+
+// batchGroup is a set of settings read with one BatchGet call: the same
+// spreadsheet and the same render options.
+type batchGroup struct {
+	id             string
+	valueRender    string
+	dateTimeRender string
+	idx            []int
+}
+
+// selectConfigs returns the sorted names of the settings matching names, all
+// or tag. Unknown names are returned as errors so that they can be reported
+// alongside the other results.
+func selectConfigs(configs map[string]Config, names []string, all bool, tag string) ([]string, map[string]error) {
+	missing := make(map[string]error)
+	var selected []string
+	if all || tag != "" {
+		for name, c := range configs {
+			if all || c.HasTag(tag) {
+				selected = append(selected, name)
+			}
+		}
+		sort.Strings(selected)
+	}
+	for _, name := range names {
+		if _, ok := configs[name]; !ok {
+			missing[name] = fmt.Errorf("setting not found in config file")
+		}
+		selected = append(selected, name)
+	}
+	return selected, missing
+}
+
+// fetchBatch fetches many settings at once. Settings are grouped by
+// spreadsheet so that each spreadsheet is read with a single BatchGet call
+// (per render option), and up to jobs groups are read concurrently. A
+// failure only affects the settings it concerns.
+func fetchBatch(srv *sheets.Service, names []string, configs map[string]Config, errs map[string]error, jobs int) []getResult {
+	results := make([]getResult, len(names))
+	groups := make(map[string]*batchGroup)
+	var order []*batchGroup
+	for i, name := range names {
+		results[i].Name = name
+		if err := errs[name]; err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		c := configs[name]
+		id := spreadsheetID(c.Spreadsheet)
+		valueRender, dateTimeRender := c.renderOptions()
+		key := id + "\x00" + valueRender + "\x00" + dateTimeRender
+		g, ok := groups[key]
+		if !ok {
+			g = &batchGroup{id: id, valueRender: valueRender, dateTimeRender: dateTimeRender}
+			groups[key] = g
+			order = append(order, g)
+		}
+		g.idx = append(g.idx, i)
+	}
+
+	if jobs < 1 {
+		jobs = 1
+	}
+	work := make(chan *batchGroup)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range work {
+				// Each group only writes to its own indexes of results.
+				fetchGroup(srv, g, names, configs, results)
+			}
+		}()
+	}
+	for _, g := range order {
+		work <- g
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
+
+// fetchGroup reads the settings of a group. If the combined request fails,
+// each setting is retried on its own so that one broken setting does not
+// hide the others.
+func fetchGroup(srv *sheets.Service, g *batchGroup, names []string, configs map[string]Config, results []getResult) {
+	var ranges []string
+	for _, i := range g.idx {
+		ranges = append(ranges, configs[names[i]].ranges()...)
+	}
+
+	resp, err := srv.Spreadsheets.Values.BatchGet(g.id).
+		Ranges(ranges...).
+		ValueRenderOption(g.valueRender).
+		DateTimeRenderOption(g.dateTimeRender).
+		Do()
+	if err != nil && len(g.idx) == 1 {
+		setResult(&results[g.idx[0]], "", false, err)
+		return
+	}
+	if err != nil {
+		for _, i := range g.idx {
+			value, found, err := fetchSetting(srv, configs[names[i]])
+			setResult(&results[i], value, found, err)
+		}
+		return
+	}
+
+	offset := 0
+	for _, i := range g.idx {
+		c := configs[names[i]]
+		n := len(c.ranges())
+		end := offset + n
+		if end > len(resp.ValueRanges) {
+			end = len(resp.ValueRanges)
+		}
+		vrs := resp.ValueRanges[offset:end]
+		var dates []bool
+		if c.needsDateCells(vrs) {
+			if dates, err = fetchDateCells(srv, c); err != nil {
+				setResult(&results[i], "", false, err)
+				offset += n
+				continue
+			}
+		}
+		value, found, err := c.settingValue(vrs, dates)
+		setResult(&results[i], value, found, err)
+		offset += n
+	}
+}
+
+func setResult(r *getResult, value interface{}, found bool, err error) {
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+	r.Value, r.Text, r.Found = value, valueText(value), found
+}
+
+// writeResults prints results as a table or as JSON. Sensitive values are
+// masked in both.
+func writeResults(w io.Writer, results []getResult, asJSON bool) error {
+	for i, r := range results {
+		if r.Sensitive && r.Found {
+			results[i].Value, results[i].Text = maskedValue, maskedValue
+		}
+	}
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVALUE\tERROR")
+	for _, r := range results {
+		value := strings.ReplaceAll(r.Text, "\n", `\n`)
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, value, r.Error)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cachedValue is the last value fetched for a setting.
+type cachedValue struct {
+	Value     string    `json:"value"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// valueCachePath returns the path of the value cache file.
+func valueCachePath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cache", "values.json"), nil
+}
+
+// loadValueCache reads the value cache. It is only used for previews, so any
+// error simply yields an empty cache.
+func loadValueCache() map[string]cachedValue {
+	cache := make(map[string]cachedValue)
+	path, err := valueCachePath()
+	if err != nil {
+		return cache
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	_ = json.Unmarshal(data, &cache)
+	return cache
+}
+
+// cacheValues records freshly fetched values. Errors are ignored since the
+// cache is best effort.
+func cacheValues(values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	path, err := valueCachePath()
+	if err != nil {
+		return
+	}
+
+	cache := loadValueCache()
+	now := time.Now()
+	for name, v := range values {
+		cache[name] = cachedValue{Value: v, FetchedAt: now}
+	}
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, data, 0600)
+}
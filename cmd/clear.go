@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	clearAfterFlag     time.Duration
+	clearClipboardFlag string
+)
+
+// clearCmd is started in the background by 'get' for settings with a clear
+// timeout. It reads a clearRequest from stdin.
+var clearCmd = &cobra.Command{
+	Use:    "clear-clipboard",
+	Short:  "Restore the clipboard after a sensitive value was copied",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var req clearRequest
+		if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+			os.Exit(1)
+		}
+		sink, err := openSink(clearClipboardFlag)
+		if err != nil {
+			os.Exit(1)
+		}
+		time.Sleep(clearAfterFlag)
+
+		current, err := sink.Read()
+		if err != nil || hashValue(current) != req.Hash {
+			// 別の値がコピーされていればそのままにする
+			return
+		}
+		sink.Write(req.Previous)
+	},
+}
+
+func init() {
+	clearCmd.Flags().DurationVar(&clearAfterFlag, "after", defaultClearAfter, "Time to wait before clearing")
+	clearCmd.Flags().StringVar(&clearClipboardFlag, "clipboard", clipboardSystem, "Clipboard to clear")
+	rootCmd.AddCommand(clearCmd)
+}
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/atotto/clipboard"
+)
+
+// Clipboard specs accepted by --clipboard, a setting's clipboard field and
+// CELL_CLIP_CLIPBOARD. file: and command: take an argument.
+const (
+	clipboardAuto    = "auto"
+	clipboardSystem  = "system"
+	clipboardPrimary = "primary"
+	clipboardOSC52   = "osc52"
+	clipboardTmux    = "tmux"
+	clipboardFile    = "file:"
+	clipboardCommand = "command:"
+	clipboardType    = "type"
+)
+
+// clipboardEnv selects the clipboard for settings that do not name one.
+const clipboardEnv = "CELL_CLIP_CLIPBOARD"
+
+// errCannotRead is returned by sinks that can only write.
+var errCannotRead = errors.New("the clipboard cannot be read")
+
+// clipboardSink is somewhere copied values go.
+type clipboardSink interface {
+	Write(text string) error
+	// Read returns the current contents, or errCannotRead.
+	Read() (string, error)
+	// Target describes the sink in messages, e.g. "clipboard".
+	Target() string
+	// Spec is the spec that openSink turns back into this sink.
+	Spec() string
+}
+
+// sink returns the clipboard of a setting: its clipboard field, or else
+// CELL_CLIP_CLIPBOARD, or else auto.
+func (c Config) sink() (clipboardSink, error) {
+	spec := c.Clipboard
+	if spec == "" {
+		spec = os.Getenv(clipboardEnv)
+	}
+	return openSink(spec)
+}
+
+// openSink parses a clipboard spec. "auto" uses OSC 52 inside an SSH session,
+// where the system clipboard would be the remote machine's.
+func openSink(spec string) (clipboardSink, error) {
+	switch {
+	case spec == "" || spec == clipboardAuto:
+		if os.Getenv("SSH_TTY") != "" {
+			return osc52Sink{}, nil
+		}
+		return systemSink{}, nil
+	case spec == clipboardSystem:
+		return systemSink{}, nil
+	case spec == clipboardPrimary:
+		return primarySink(), nil
+	case spec == clipboardOSC52:
+		return osc52Sink{}, nil
+	case spec == clipboardType:
+		return newTypeSink(), nil
+	case spec == clipboardTmux:
+		return commandSink{
+			spec:   clipboardTmux,
+			target: "tmux buffer",
+			copy:   []string{"tmux", "load-buffer", "-"},
+			paste:  []string{"tmux", "save-buffer", "-"},
+		}, nil
+	case strings.HasPrefix(spec, clipboardFile):
+		path := strings.TrimPrefix(spec, clipboardFile)
+		if path == "" {
+			return nil, fmt.Errorf("invalid clipboard %q: file: needs a path", spec)
+		}
+		return fileSink{path: path}, nil
+	case strings.HasPrefix(spec, clipboardCommand):
+		line := strings.TrimSpace(strings.TrimPrefix(spec, clipboardCommand))
+		if line == "" {
+			return nil, fmt.Errorf("invalid clipboard %q: command: needs a command", spec)
+		}
+		return commandSink{spec: spec, target: "command", copy: shellCommand(line)}, nil
+	}
+	return nil, fmt.Errorf("invalid clipboard %q: use auto, system, primary, osc52, tmux, type, file:PATH or command:CMD", spec)
+}
+
+// systemSink is the system clipboard (the CLIPBOARD selection on X11 and
+// Wayland). It only offers text/plain, so sensitive values carry no
+// x-kde-passwordManagerHint: that takes a second target served by the same
+// selection owner, which the command-line clipboard tools cannot provide.
+type systemSink struct{}
+
+func (systemSink) Write(text string) error { return clipboard.WriteAll(text) }
+func (systemSink) Read() (string, error)   { return clipboard.ReadAll() }
+func (systemSink) Target() string          { return "clipboard" }
+func (systemSink) Spec() string            { return clipboardSystem }
+
+// osc52Sink copies through the terminal, see writeOSC52.
+type osc52Sink struct{}
+
+func (osc52Sink) Write(text string) error { return writeOSC52(text) }
+func (osc52Sink) Read() (string, error)   { return "", errCannotRead }
+func (osc52Sink) Target() string          { return "clipboard" }
+func (osc52Sink) Spec() string            { return clipboardOSC52 }
+
+// fileSink writes values to a file, readable only by the user.
+type fileSink struct {
+	path string
+}
+
+func (s fileSink) Write(text string) error {
+	return os.WriteFile(expandHome(s.path), []byte(text), 0600)
+}
+
+func (s fileSink) Read() (string, error) {
+	data, err := os.ReadFile(expandHome(s.path))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+func (s fileSink) Target() string { return s.path }
+func (s fileSink) Spec() string   { return clipboardFile + s.path }
+
+// commandRunner runs argv with stdin and returns its stdout. Sinks that
+// drive external tools take one, so that the tools can be replaced in tests.
+type commandRunner func(argv []string, stdin string) (string, error)
+
+// execCommand is the commandRunner that runs real commands.
+func execCommand(argv []string, stdin string) (string, error) {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", commandError(argv[0], err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// commandSink pipes values to a command's stdin, and reads them from another
+// command's stdout if paste is set.
+type commandSink struct {
+	spec   string
+	target string
+	copy   []string
+	paste  []string
+	run    commandRunner
+}
+
+func (s commandSink) runner() commandRunner {
+	if s.run == nil {
+		return execCommand
+	}
+	return s.run
+}
+
+func (s commandSink) Write(text string) error {
+	_, err := s.runner()(s.copy, text)
+	return err
+}
+
+func (s commandSink) Read() (string, error) {
+	if len(s.paste) == 0 {
+		return "", errCannotRead
+	}
+	return s.runner()(s.paste, "")
+}
+
+func (s commandSink) Target() string { return s.target }
+func (s commandSink) Spec() string   { return s.spec }
+
+// primarySink returns the PRIMARY selection sink for the running display
+// server, using wl-clipboard on Wayland and xclip or xsel on X11.
+func primarySink() commandSink {
+	s := commandSink{spec: clipboardPrimary, target: "primary selection"}
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		s.copy = []string{"wl-copy", "--primary"}
+		s.paste = []string{"wl-paste", "--primary", "--no-newline"}
+	case hasCommand("xclip"):
+		s.copy = []string{"xclip", "-in", "-selection", "primary"}
+		s.paste = []string{"xclip", "-out", "-selection", "primary"}
+	default:
+		s.copy = []string{"xsel", "--input", "--primary"}
+		s.paste = []string{"xsel", "--output", "--primary"}
+	}
+	return s
+}
+
+// shellCommand returns the argv that runs line with the system shell.
+func shellCommand(line string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", line}
+	}
+	return []string{"sh", "-c", line}
+}
+
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// commandError adds the command's stderr to its error.
+func commandError(name string, err error, stderr string) error {
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return fmt.Errorf("%s: %w: %s", name, err, msg)
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
+
+// expandHome expands a leading ~/ in path.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// copyValue copies (or types) text with the sink and reports it. When the
+// setting has a clear timeout, the previous contents are restored after it by
+// a background process, unless something else was copied meanwhile.
+func copyValue(c Config, sink clipboardSink, text string) error {
+	wait, _ := c.clearAfter()
+	_, typing := sink.(typeSink)
+	var previous string
+	if wait > 0 {
+		var err error
+		previous, err = sink.Read()
+		if err == errCannotRead {
+			// 入力した文字は消せないが、警告する必要もない
+			if !typing {
+				fmt.Fprintf(os.Stderr, "Warning: the %s clipboard cannot be cleared automatically\n", sink.Spec())
+			}
+			wait = 0
+		}
+		// 同じ値を続けて取得した場合に値を復元してしまわないようにする
+		if previous == text {
+			previous = ""
+		}
+	}
+	if err := sink.Write(text); err != nil {
+		return err
+	}
+
+	shown := c.displayValue(text)
+	if typing {
+		fmt.Printf("Typed: %s\n", shown)
+		return nil
+	}
+	if wait <= 0 {
+		fmt.Printf("Copied to %s: %s\n", sink.Target(), shown)
+		return nil
+	}
+	if err := scheduleClear(sink, text, previous, wait); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to schedule clearing the clipboard: %v\n", err)
+		fmt.Printf("Copied to %s: %s\n", sink.Target(), shown)
+		return nil
+	}
+	fmt.Printf("Copied to %s: %s (cleared in %s)\n", sink.Target(), shown, wait)
+	return nil
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCommandSinkTmux(t *testing.T) {
+	sink, err := openSink(clipboardTmux)
+	if err != nil {
+		t.Fatalf("openSink: %v", err)
+	}
+	s, ok := sink.(commandSink)
+	if !ok {
+		t.Fatalf("openSink(%q) = %T, want commandSink", clipboardTmux, sink)
+	}
+	r := fakeRunner{out: "pasted"}
+	s.run = r.run
+
+	if err := s.Write("copied"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got, err := s.Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if got != "pasted" {
+		t.Errorf("Read = %q, want %q", got, "pasted")
+	}
+
+	want := [][]string{
+		{"tmux", "load-buffer", "-"},
+		{"tmux", "save-buffer", "-"},
+	}
+	if !reflect.DeepEqual(r.argv, want) {
+		t.Errorf("argv = %q, want %q", r.argv, want)
+	}
+	if r.stdin[0] != "copied" {
+		t.Errorf("stdin = %q, want %q", r.stdin[0], "copied")
+	}
+}
+
+func TestPrimarySink(t *testing.T) {
+	// xclip だけがある PATH
+	withXclip := t.TempDir()
+	if err := os.WriteFile(filepath.Join(withXclip, "xclip"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		wayland   string
+		path      string
+		wantCopy  []string
+		wantPaste []string
+	}{
+		{
+			name:      "Wayland",
+			wayland:   "wayland-0",
+			path:      withXclip,
+			wantCopy:  []string{"wl-copy", "--primary"},
+			wantPaste: []string{"wl-paste", "--primary", "--no-newline"},
+		},
+		{
+			name:      "xclip",
+			path:      withXclip,
+			wantCopy:  []string{"xclip", "-in", "-selection", "primary"},
+			wantPaste: []string{"xclip", "-out", "-selection", "primary"},
+		},
+		{
+			name:      "xsel",
+			path:      t.TempDir(),
+			wantCopy:  []string{"xsel", "--input", "--primary"},
+			wantPaste: []string{"xsel", "--output", "--primary"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WAYLAND_DISPLAY", tt.wayland)
+			t.Setenv("PATH", tt.path)
+
+			s := primarySink()
+			r := fakeRunner{out: "pasted"}
+			s.run = r.run
+			if err := s.Write("copied"); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if _, err := s.Read(); err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+
+			want := [][]string{tt.wantCopy, tt.wantPaste}
+			if !reflect.DeepEqual(r.argv, want) {
+				t.Errorf("argv = %q, want %q", r.argv, want)
+			}
+			if r.stdin[0] != "copied" {
+				t.Errorf("stdin = %q, want %q", r.stdin[0], "copied")
+			}
+		})
+	}
+}
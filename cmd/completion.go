@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// completeSettingNames completes the names of registered settings.
+func completeSettingNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	configs, err := loadConfigs()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	given := make(map[string]bool, len(args))
+	for _, a := range args {
+		given[a] = true
+	}
+	var names []string
+	for name := range configs {
+		if strings.HasPrefix(name, toComplete) && !given[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFirstSettingName completes a setting name for the first argument only.
+func completeFirstSettingName(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeSettingNames(cmd, args, toComplete)
+}
+
+// completeGetArgs completes setting names, unless the first setting takes
+// positional arguments.
+func completeGetArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		configs, err := loadConfigs()
+		if err != nil || configs[args[0]].PositionalArgs() > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+	}
+	return completeSettingNames(cmd, args, toComplete)
+}
+
+// completeSheetNames completes sheet names from the cached metadata of the
+// spreadsheet used by the setting given as the first argument, or of every
+// known spreadsheet when there is none.
+func completeSheetNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	configs, err := loadConfigs()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	ids := make(map[string]bool)
+	if len(args) > 0 {
+		if c, ok := configs[args[0]]; ok {
+			ids[spreadsheetID(c.Spreadsheet)] = true
+		}
+	}
+	if len(ids) == 0 {
+		for _, c := range configs {
+			ids[spreadsheetID(c.Spreadsheet)] = true
+		}
+	}
+
+	cache := loadMetaCache()
+	seen := make(map[string]bool)
+	var titles []string
+	for id := range ids {
+		meta, ok := cache[id]
+		if !ok || meta == nil {
+			continue
+		}
+		for _, t := range meta.sheetTitles() {
+			if strings.HasPrefix(t, toComplete) && !seen[t] {
+				seen[t] = true
+				titles = append(titles, t)
+			}
+		}
+	}
+	sort.Strings(titles)
+	return titles, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTags completes the tags used by any setting.
+func completeTags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completeConfigValues(toComplete, func(c Config) []string { return c.Tags })
+}
+
+// completeGroups completes the groups used by any setting.
+func completeGroups(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completeConfigValues(toComplete, func(c Config) []string { return []string{c.Group} })
+}
+
+func completeConfigValues(toComplete string, values func(Config) []string) ([]string, cobra.ShellCompDirective) {
+	configs, err := loadConfigs()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for _, c := range configs {
+		for _, v := range values(c) {
+			if v != "" && strings.HasPrefix(v, toComplete) && !seen[v] {
+				seen[v] = true
+				out = append(out, v)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, cobra.ShellCompDirectiveNoFileComp
+}
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Generate or install shell completion scripts",
+	Long: "Generate a shell completion script and print it to stdout, for example:\n\n" +
+		"  source <(cell-clip completion bash)\n\n" +
+		"Use 'cell-clip completion install' to write the script to the usual location\n" +
+		"for your shell instead.",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := writeCompletion(args[0], os.Stdout); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+var completionInstallCmd = &cobra.Command{
+	Use:   "install [bash|zsh|fish]",
+	Short: "Install the completion script for your shell",
+	Long: "Write the completion script to the location where the shell loads it from.\n" +
+		"The shell is taken from $SHELL when not given.",
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Run: func(cmd *cobra.Command, args []string) {
+		shell := filepath.Base(os.Getenv("SHELL"))
+		if len(args) > 0 {
+			shell = args[0]
+		}
+
+		path, hint, err := completionInstallPath(shell)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			log.Fatalf("Unable to create directory %s: %v", filepath.Dir(path), err)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			log.Fatalf("Unable to create completion file: %v", err)
+		}
+		defer f.Close()
+		if err := writeCompletion(shell, f); err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		fmt.Printf("✓ Installed %s completion to: %s\n", shell, path)
+		if hint != "" {
+			fmt.Println(hint)
+		}
+	},
+}
+
+// writeCompletion writes the completion script for shell.
+func writeCompletion(shell string, f *os.File) error {
+	switch shell {
+	case "bash":
+		return rootCmd.GenBashCompletionV2(f, true)
+	case "zsh":
+		return rootCmd.GenZshCompletion(f)
+	case "fish":
+		return rootCmd.GenFishCompletion(f, true)
+	case "powershell":
+		return rootCmd.GenPowerShellCompletionWithDesc(f)
+	}
+	return fmt.Errorf("unsupported shell %q: use bash, zsh, fish or powershell", shell)
+}
+
+// completionInstallPath returns where the completion script for shell is
+// installed, and what the user still has to do to enable it, if anything.
+func completionInstallPath(shell string) (path, hint string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("unable to get home directory: %w", err)
+	}
+
+	switch shell {
+	case "bash":
+		dir := os.Getenv("XDG_DATA_HOME")
+		if dir == "" {
+			dir = filepath.Join(home, ".local", "share")
+		}
+		return filepath.Join(dir, "bash-completion", "completions", "cell-clip"),
+			"✓ Requires the bash-completion package. Restart your shell to enable it.", nil
+	case "zsh":
+		dir := filepath.Join(home, ".zfunc")
+		return filepath.Join(dir, "_cell-clip"),
+			"✓ Add the following to your ~/.zshrc before 'compinit' if it is not there yet:\n" +
+				"  fpath=(~/.zfunc $fpath)", nil
+	case "fish":
+		dir := os.Getenv("XDG_CONFIG_HOME")
+		if dir == "" {
+			dir = filepath.Join(home, ".config")
+		}
+		return filepath.Join(dir, "fish", "completions", "cell-clip.fish"), "", nil
+	}
+	return "", "", fmt.Errorf("cannot install completion for shell %q: use bash, zsh or fish", shell)
+}
+
+func init() {
+	completionCmd.AddCommand(completionInstallCmd)
+	rootCmd.AddCommand(completionCmd)
+}
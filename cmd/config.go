@@ -0,0 +1,568 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Row is the row number of a setting. It is kept as a string so that it can
+// hold a placeholder such as "{{.Arg2}}", but is written back as a plain
+// number whenever possible.
+type Row string
+
+// MarshalYAML writes numeric rows without quotes.
+func (r Row) MarshalYAML() (interface{}, error) {
+	if n, err := strconv.Atoi(string(r)); err == nil {
+		return n, nil
+	}
+	return string(r), nil
+}
+
+// MarshalJSON writes numeric rows as numbers, like MarshalYAML.
+func (r Row) MarshalJSON() ([]byte, error) {
+	if n, err := strconv.Atoi(string(r)); err == nil {
+		return json.Marshal(n)
+	}
+	return json.Marshal(string(r))
+}
+
+// UnmarshalJSON accepts rows written as numbers as well as strings.
+func (r *Row) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		*r = Row(n.String())
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid row %s: must be a number or a string", data)
+	}
+	*r = Row(s)
+	return nil
+}
+
+// configDir returns the directory holding all cell-clip files.
+func configDir() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("unable to get current user: %w", err)
+	}
+	return filepath.Join(usr.HomeDir, ".cell-clip"), nil
+}
+
+// configPath returns the path of the settings file.
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yml"), nil
+}
+
+// includeKey is the key of config.yml listing shared settings files.
+const includeKey = "include"
+
+// projectConfigName is the name of project settings files, looked up from the
+// working directory upwards.
+const projectConfigName = ".cell-clip.yml"
+
+// configFile is the layout of a settings file: its version, settings by
+// name, and in config.yml, files or directories of shared settings to
+// include. Older layouts are upgraded by decodeConfigFile.
+type configFile struct {
+	Version  int               `yaml:"version"`
+	Include  []string          `yaml:"include,omitempty"`
+	Settings map[string]Config `yaml:"settings"`
+}
+
+// configLayers holds the settings of config.yml (the local layer), of the
+// files it includes, and of the project's .cell-clip.yml.
+type configLayers struct {
+	Path     string
+	Include  []string
+	Local    map[string]Config
+	Included map[string]Config
+	// ProjectPath is the .cell-clip.yml found from the working directory,
+	// or empty.
+	ProjectPath string
+	Project     map[string]Config
+	// Sources maps each setting to the file it is read from.
+	Sources map[string]string
+}
+
+// loadConfigs reads all settings: included settings, overridden by
+// config.yml, overridden by the project's .cell-clip.yml. Missing files
+// yield an empty map.
+func loadConfigs() (map[string]Config, error) {
+	layers, err := loadConfigLayers()
+	if err != nil {
+		return nil, err
+	}
+	return layers.merged(), nil
+}
+
+// warnedIncludes records the includes already reported as missing, since
+// settings may be loaded several times by one command.
+var warnedIncludes sync.Map
+
+// warnedClipboard reports the ignored clipboard fields of a project file
+// once.
+var warnedClipboard sync.Once
+
+// loadConfigLayers reads config.yml, the files it includes and the project
+// file. Include paths are relative to config.yml; directories include their
+// .yml and .yaml files in name order, and later files override earlier ones.
+// Includes that do not exist are reported and skipped, so that a missing
+// team checkout does not break every command.
+func loadConfigLayers() (*configLayers, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	layers := &configLayers{
+		Path:     path,
+		Local:    make(map[string]Config),
+		Included: make(map[string]Config),
+		Project:  make(map[string]Config),
+		Sources:  make(map[string]string),
+	}
+
+	local, from, err := readConfigFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil && from < configVersion {
+		// 古い形式は元のファイルを残して書き換える。失敗しても読み込みは続ける
+		if backup, err := upgradeConfigFile(path, local, from); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: unable to upgrade %s: %v\n", path, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Upgraded %s from version %d to %d (original saved as %s)\n",
+				path, from, configVersion, backup)
+		}
+	}
+	layers.Include = local.Include
+
+	for _, inc := range local.Include {
+		files, err := includeFiles(filepath.Dir(path), inc)
+		if err != nil {
+			if _, warned := warnedIncludes.LoadOrStore(inc, true); !warned {
+				fmt.Fprintf(os.Stderr, "Warning: skipping include %q: %v\n", inc, err)
+			}
+			continue
+		}
+		for _, file := range files {
+			f, _, err := readConfigFile(file)
+			if err != nil {
+				return nil, err
+			}
+			for name, c := range f.Settings {
+				layers.Included[name] = c
+				layers.Sources[name] = file
+			}
+		}
+	}
+	for name, c := range local.Settings {
+		layers.Local[name] = c
+		layers.Sources[name] = path
+	}
+
+	if project, ok := findProjectConfig(); ok && project != path {
+		f, _, err := readConfigFile(project)
+		if err != nil {
+			return nil, err
+		}
+		layers.ProjectPath = project
+		for name, c := range f.Settings {
+			layers.Project[name] = c
+			layers.Sources[name] = project
+		}
+	}
+	return layers, nil
+}
+
+// findProjectConfig looks for .cell-clip.yml in the working directory and
+// its parents, and returns the nearest one.
+func findProjectConfig() (string, bool) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// readConfigFile parses one settings file and returns it in the current
+// layout, along with the version it was written in. Included and project
+// files are upgraded in memory only; they are rewritten in the current
+// layout when cell-clip saves them.
+func readConfigFile(path string) (configFile, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return configFile{}, 0, fmt.Errorf("unable to read config file: %w", err)
+	}
+	return decodeConfigFile(path, data)
+}
+
+// writeConfigFile writes one settings file in the current layout.
+func writeConfigFile(path string, f configFile) error {
+	f.Version = configVersion
+	if f.Settings == nil {
+		f.Settings = make(map[string]Config)
+	}
+	data, err := yaml.Marshal(&f)
+	if err != nil {
+		return fmt.Errorf("unable to marshal config: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create config directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write to config file: %w", err)
+	}
+	return nil
+}
+
+// includeFiles returns the settings files an include entry refers to.
+func includeFiles(dir, inc string) ([]string, error) {
+	path := expandHome(inc)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if !e.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// merged returns the settings of all layers. Clipboard fields of the
+// project file are ignored: a repository's settings must not be able to run
+// commands when copying.
+func (l *configLayers) merged() map[string]Config {
+	configs := make(map[string]Config, len(l.Local)+len(l.Included)+len(l.Project))
+	for name, c := range l.Included {
+		configs[name] = c
+	}
+	for name, c := range l.Local {
+		configs[name] = c
+	}
+	for name, c := range l.Project {
+		if c.Clipboard != "" {
+			warnedClipboard.Do(func() {
+				fmt.Fprintf(os.Stderr, "Warning: ignoring clipboard fields in %s\n", l.ProjectPath)
+			})
+			c.Clipboard = ""
+		}
+		configs[name] = c
+	}
+	return configs
+}
+
+// isLocal reports whether a setting is defined in config.yml or the project
+// file, the files cell-clip writes to.
+func (l *configLayers) isLocal(name string) bool {
+	_, local := l.Local[name]
+	_, project := l.Project[name]
+	return local || project
+}
+
+// source returns the file a setting is read from, relative to the directory
+// of config.yml when it is inside it.
+func (l *configLayers) source(name string) string {
+	src := l.Sources[name]
+	if rel, err := filepath.Rel(filepath.Dir(l.Path), src); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return src
+}
+
+// saveConfigs writes settings back to config.yml, or to the project file
+// for settings defined there, and returns the path of config.yml. Included
+// settings are written only when they were changed, as local overrides of
+// config.yml; the included files themselves are never modified.
+func saveConfigs(configs map[string]Config) (string, error) {
+	layers, err := loadConfigLayers()
+	if err != nil {
+		return "", err
+	}
+
+	f := configFile{Include: layers.Include, Settings: make(map[string]Config)}
+	project := configFile{Settings: make(map[string]Config)}
+	projectChanged := false
+	for name, c := range configs {
+		if p, ok := layers.Project[name]; ok {
+			// 読み込み時に外したクリップボードを戻す
+			if c.Clipboard == "" {
+				c.Clipboard = p.Clipboard
+			}
+			project.Settings[name] = c
+			projectChanged = projectChanged || !reflect.DeepEqual(p, c)
+			if shadowed, ok := layers.Local[name]; ok {
+				f.Settings[name] = shadowed
+			}
+			continue
+		}
+		if inc, ok := layers.Included[name]; ok && !layers.isLocal(name) && reflect.DeepEqual(inc, c) {
+			continue
+		}
+		f.Settings[name] = c
+	}
+
+	if !reflect.DeepEqual(f.Settings, layers.Local) {
+		if err := writeConfigFile(layers.Path, f); err != nil {
+			return "", err
+		}
+	}
+	if projectChanged || len(project.Settings) != len(layers.Project) {
+		if err := writeConfigFile(layers.ProjectPath, project); err != nil {
+			return "", err
+		}
+	}
+	return layers.Path, nil
+}
+
+// saveProjectSetting adds a setting to the project file, creating
+// .cell-clip.yml in the working directory if there is none, and returns the
+// path written to.
+func saveProjectSetting(name string, c Config) (string, error) {
+	path, ok := findProjectConfig()
+	if !ok {
+		dir, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("unable to get working directory: %w", err)
+		}
+		path = filepath.Join(dir, projectConfigName)
+	}
+	f, _, err := readConfigFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	if f.Settings == nil {
+		f.Settings = make(map[string]Config)
+	}
+	f.Settings[name] = c
+	if err := writeConfigFile(path, f); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+var (
+	argPlaceholderRe = regexp.MustCompile(`\.Arg(\d+)`)
+	columnRe         = regexp.MustCompile(`^[A-Za-z]{1,3}$`)
+)
+
+// fields returns pointers to every field that may contain placeholders.
+func (c *Config) fields() []*string {
+	return []*string{&c.Spreadsheet, &c.Sheet, &c.XAxis, (*string)(&c.YAxis)}
+}
+
+// PositionalArgs returns how many positional arguments (Arg1, Arg2, ...) the
+// setting's placeholders refer to.
+func (c Config) PositionalArgs() int {
+	texts := make([]string, 0, 4+len(c.Cells))
+	for _, f := range c.fields() {
+		texts = append(texts, *f)
+	}
+	for _, ref := range c.Cells {
+		texts = append(texts, ref)
+	}
+
+	max := 0
+	for _, t := range texts {
+		for _, m := range argPlaceholderRe.FindAllStringSubmatch(t, -1) {
+			if n, _ := strconv.Atoi(m[1]); n > max {
+				max = n
+			}
+		}
+	}
+	return max
+}
+
+// Resolve fills the placeholders of the setting with the given parameters and
+// validates the result, so that mistakes are reported before any API call.
+// The template of a composite setting is left untouched; it is rendered with
+// the fetched values later.
+func (c Config) Resolve(params map[string]string) (Config, error) {
+	resolved := c
+	for _, f := range resolved.fields() {
+		s, err := expandPlaceholders(*f, params)
+		if err != nil {
+			return Config{}, err
+		}
+		*f = s
+	}
+	if c.Cells != nil {
+		resolved.Cells = make(map[string]string, len(c.Cells))
+		for name, ref := range c.Cells {
+			s, err := expandPlaceholders(ref, params)
+			if err != nil {
+				return Config{}, err
+			}
+			resolved.Cells[name] = s
+		}
+	}
+
+	if err := resolved.validate(); err != nil {
+		return Config{}, err
+	}
+	return resolved, nil
+}
+
+// expandPlaceholders renders s as a template with the given parameters.
+func expandPlaceholders(s string, params map[string]string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	tmpl, err := template.New("setting").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid placeholder in %q: %w", s, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, params); err != nil {
+		return "", fmt.Errorf("missing parameter for %q: %w", s, err)
+	}
+	return buf.String(), nil
+}
+
+// validate checks that the setting points to a single, well-formed cell, or
+// for composite settings, that every cell reference is well-formed.
+func (c Config) validate() error {
+	if c.Spreadsheet == "" {
+		return fmt.Errorf("spreadsheet is empty")
+	}
+	if err := c.validateRender(); err != nil {
+		return err
+	}
+	if err := validateTransforms(c.Transforms); err != nil {
+		return err
+	}
+	if _, err := c.clearAfter(); err != nil {
+		return err
+	}
+	if c.Clipboard != "" {
+		if _, err := openSink(c.Clipboard); err != nil {
+			return err
+		}
+	}
+	if c.Template != "" {
+		return c.validateCells()
+	}
+	if c.Sheet == "" {
+		return fmt.Errorf("sheet name is empty")
+	}
+	if !columnRe.MatchString(c.XAxis) {
+		return fmt.Errorf("invalid column %q: must be letters such as A or AB", c.XAxis)
+	}
+	if n, err := strconv.Atoi(string(c.YAxis)); err != nil || n < 1 {
+		return fmt.Errorf("invalid row %q: must be a positive number", c.YAxis)
+	}
+	return nil
+}
+
+// parseRow accepts a row number or a placeholder such as "{{.Arg1}}".
+func parseRow(s string) (Row, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "{{") {
+		return Row(s), nil
+	}
+	if _, err := strconv.Atoi(s); err != nil {
+		return "", err
+	}
+	return Row(s), nil
+}
+
+// parseTags splits a comma separated list of tags.
+func parseTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// parseParams builds template data from positional arguments and key=value
+// pairs. Positional arguments are available as Arg1, Arg2, ...
+func parseParams(args []string, pairs []string) (map[string]string, error) {
+	params := make(map[string]string)
+	for i, a := range args {
+		params[fmt.Sprintf("Arg%d", i+1)] = a
+	}
+	for _, p := range pairs {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid parameter %q: expected key=value", p)
+		}
+		params[k] = v
+	}
+	return params, nil
+}
+
+// errSettingNotFound is returned by resolveSetting for unknown names.
+var errSettingNotFound = errors.New("setting not found in config file")
+
+// resolveSetting resolves the named setting with positional arguments and
+// named parameters, for commands that take them as structured input rather
+// than as command-line arguments.
+func resolveSetting(configs map[string]Config, name string, args []string, named map[string]string) (Config, error) {
+	c, ok := configs[name]
+	if !ok {
+		return Config{}, fmt.Errorf("setting %q: %w", name, errSettingNotFound)
+	}
+	if n := c.PositionalArgs(); len(args) > n {
+		return Config{}, fmt.Errorf("setting %q takes %d argument(s), got %d", name, n, len(args))
+	}
+	params, err := parseParams(args, nil)
+	if err != nil {
+		return Config{}, err
+	}
+	for k, v := range named {
+		params[k] = v
+	}
+	resolved, err := c.Resolve(params)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid setting %q: %w", name, err)
+	}
+	return resolved, nil
+}
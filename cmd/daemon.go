@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// daemonHost is the host name of requests sent over the daemon's socket.
+const daemonHost = "cell-clip.daemon"
+
+// sheetsAPI is where the daemon forwards Sheets API requests.
+const sheetsAPI = "https://sheets.googleapis.com"
+
+// daemonMetaTTL is how long the daemon reuses spreadsheet metadata.
+const daemonMetaTTL = time.Minute
+
+// noDaemonEnv disables the daemon for a command when set.
+const noDaemonEnv = "CELL_CLIP_NO_DAEMON"
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep an authenticated Sheets client running to speed up get",
+	Long: "Run in the foreground, holding the OAuth client and a warm connection to the\n" +
+		"Sheets API, and serve other cell-clip commands on a Unix socket readable only by\n" +
+		"you (~/.cell-clip/run/daemon.sock). Commands that read spreadsheets use the\n" +
+		"daemon when it is running and connect directly otherwise; set " + noDaemonEnv + "=1\n" +
+		"to bypass it. Spreadsheet metadata is reused for up to a minute unless a\n" +
+		"command asks for the current tabs, such as after a rename; values are\n" +
+		"always read fresh.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := daemonSocketPath()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if _, err := daemonStatus(path); err == nil {
+			log.Fatalf("A daemon is already running on %s", path)
+		}
+
+		oauthManager, err := NewOAuthManager()
+		if err != nil {
+			log.Fatalf("Unable to initialize OAuth manager: %v", err)
+		}
+		client, err := oauthManager.GetAuthenticatedClient()
+		if err != nil {
+			log.Fatalf("Unable to get authenticated client: %v", err)
+		}
+
+		// ソケットは 0700 のディレクトリに作り、作成直後の競合も避ける
+		if err := prepareSocketDir(filepath.Dir(path)); err != nil {
+			log.Fatalf("%v", err)
+		}
+		os.Remove(path)
+		ln, err := listenSocket(path)
+		if err != nil {
+			log.Fatalf("Unable to listen on %s: %v", path, err)
+		}
+
+		d := newDaemon(client.Transport)
+		srv := &http.Server{Handler: d}
+		d.stop = func() { go srv.Shutdown(context.Background()) }
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(ctx)
+		}()
+
+		log.Printf("Listening on %s", path)
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("%v", err)
+		}
+		os.Remove(path)
+		log.Printf("Stopped after %d request(s)", d.requests.Load())
+	},
+}
+
+// prepareSocketDir creates the socket's directory, or restricts an existing
+// one that MkdirAll would leave as it is, and refuses to go on if others can
+// still reach into it.
+func prepareSocketDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("unable to create %s: %w", dir, err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return fmt.Errorf("unable to restrict %s: %w", dir, err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() || (runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0) {
+		return fmt.Errorf("%s must be a directory accessible only by you (mode %v)", dir, info.Mode())
+	}
+	return nil
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the daemon is running",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := daemonSocketPath()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		st, err := daemonStatus(path)
+		if err != nil {
+			fmt.Println("The daemon is not running.")
+			os.Exit(1)
+		}
+		fmt.Printf("Running on %s (pid %d, since %s, %d request(s))\n",
+			path, st.PID, st.Started.Format("2006-01-02 15:04"), st.Requests)
+	},
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the daemon",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := daemonSocketPath()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		resp, err := daemonClient(path).Post("http://"+daemonHost+"/cell-clip/stop", "", nil)
+		if err != nil {
+			fmt.Println("The daemon is not running.")
+			return
+		}
+		resp.Body.Close()
+		fmt.Println("The daemon was stopped.")
+	},
+}
+
+// daemonInfo is what /cell-clip/status reports.
+type daemonInfo struct {
+	PID      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+	Requests int64     `json:"requests"`
+}
+
+// daemon forwards Sheets API requests with its authenticated transport.
+type daemon struct {
+	proxy    *httputil.ReverseProxy
+	started  time.Time
+	requests atomic.Int64
+	stop     func()
+}
+
+func newDaemon(transport http.RoundTripper) *daemon {
+	api, _ := url.Parse(sheetsAPI)
+	return &daemon{
+		proxy: &httputil.ReverseProxy{
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.SetURL(api)
+				r.Out.Host = api.Host
+			},
+			Transport: &metaCache{next: transport, entries: make(map[string]metaCacheEntry)},
+		},
+		started: time.Now(),
+	}
+}
+
+func (d *daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/cell-clip/status":
+		json.NewEncoder(w).Encode(daemonInfo{PID: os.Getpid(), Started: d.started, Requests: d.requests.Load()})
+		return
+	case "/cell-clip/stop":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		d.stop()
+		return
+	}
+	d.requests.Add(1)
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	d.proxy.ServeHTTP(rec, r)
+	log.Printf("%s %s %d %s", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+}
+
+// statusRecorder remembers the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// metaRequestRe matches spreadsheet metadata requests, as opposed to value
+// requests (/values/...) and updates (:batchUpdate).
+var metaRequestRe = regexp.MustCompile(`^/v4/spreadsheets/[^/:]+$`)
+
+// metaCache is a RoundTripper that reuses successful metadata responses for
+// daemonMetaTTL. Requests with grid data are not cached, and requests with
+// "Cache-Control: no-cache" always go to the API (their response is cached).
+type metaCache struct {
+	next    http.RoundTripper
+	mu      sync.Mutex
+	entries map[string]metaCacheEntry
+}
+
+type metaCacheEntry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+func (c *metaCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	cacheable := req.Method == http.MethodGet && metaRequestRe.MatchString(req.URL.Path) &&
+		req.URL.Query().Get("includeGridData") != "true"
+	if !cacheable {
+		return c.next.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expires) && req.Header.Get("Cache-Control") != "no-cache" {
+		return &http.Response{
+			StatusCode: e.status,
+			Header:     e.header.Clone(),
+			Body:       io.NopCloser(bytes.NewReader(e.body)),
+			Request:    req,
+		}, nil
+	}
+
+	resp, err := c.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[key] = metaCacheEntry{status: resp.StatusCode, header: resp.Header.Clone(), body: body, expires: time.Now().Add(daemonMetaTTL)}
+	c.mu.Unlock()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// daemonSocketPath returns the path of the daemon's socket.
+func daemonSocketPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "run", "daemon.sock"), nil
+}
+
+// daemonClient returns an HTTP client that talks to the daemon's socket.
+func daemonClient(path string) *http.Client {
+	dialer := &net.Dialer{Timeout: 200 * time.Millisecond}
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+// daemonStatus asks the daemon on path for its status.
+func daemonStatus(path string) (*daemonInfo, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	c := daemonClient(path)
+	c.Timeout = time.Second
+	resp, err := c.Get("http://" + daemonHost + "/cell-clip/status")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var st daemonInfo
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// daemonSheetsService returns a Sheets client that goes through the daemon,
+// or false if no daemon is running.
+func daemonSheetsService() (*sheets.Service, bool) {
+	if os.Getenv(noDaemonEnv) != "" {
+		return nil, false
+	}
+	path, err := daemonSocketPath()
+	if err != nil {
+		return nil, false
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, false
+	}
+	conn, err := net.DialTimeout("unix", path, 200*time.Millisecond)
+	if err != nil {
+		return nil, false
+	}
+	conn.Close()
+
+	srv, err := sheets.NewService(context.Background(),
+		option.WithHTTPClient(daemonClient(path)),
+		option.WithEndpoint("http://"+daemonHost+"/"))
+	if err != nil {
+		return nil, false
+	}
+	return srv, true
+}
+
+func init() {
+	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonCmd.AddCommand(daemonStopCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
@@ -0,0 +1,99 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrepareSocketDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "run")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := prepareSocketDir(dir); err != nil {
+		t.Fatalf("prepareSocketDir: %v", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("mode = %v, want 0700", info.Mode().Perm())
+	}
+
+	path := filepath.Join(dir, "test.sock")
+	ln, err := listenSocket(path)
+	if err != nil {
+		t.Fatalf("listenSocket: %v", err)
+	}
+	defer ln.Close()
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+// countingTransport answers every request with the number of requests seen.
+type countingTransport struct{ n int }
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.n++
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(strings.Repeat("x", t.n))),
+		Request:    req,
+	}, nil
+}
+
+func TestMetaCache(t *testing.T) {
+	next := &countingTransport{}
+	c := &metaCache{next: next, entries: make(map[string]metaCacheEntry)}
+	get := func(url string, header ...string) string {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(header) > 0 {
+			req.Header.Set("Cache-Control", header[0])
+		}
+		resp, err := c.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	const meta = sheetsAPI + "/v4/spreadsheets/ID?fields=sheets"
+	if got := get(meta); got != "x" {
+		t.Errorf("first request = %q, want %q", got, "x")
+	}
+	if got := get(meta); got != "x" {
+		t.Errorf("cached request = %q, want %q", got, "x")
+	}
+	// 強制的な再取得はキャッシュを使わず、その結果を記録する
+	if got := get(meta, "no-cache"); got != "xx" {
+		t.Errorf("no-cache request = %q, want %q", got, "xx")
+	}
+	if got := get(meta); got != "xx" {
+		t.Errorf("request after no-cache = %q, want %q", got, "xx")
+	}
+	if got := get(sheetsAPI + "/v4/spreadsheets/ID/values/A1"); got != "xxx" {
+		t.Errorf("value request = %q, want %q", got, "xxx")
+	}
+	if next.n != 3 {
+		t.Errorf("%d request(s) reached the API, want 3", next.n)
+	}
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf16"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// What 'get --what' can copy besides the value.
+const (
+	whatValue         = "value"
+	whatNote          = "note"
+	whatHyperlink     = "hyperlink"
+	whatFormattedText = "formatted-text"
+	whatAll           = "all"
+)
+
+// checkWhat rejects unknown --what values before anything is fetched.
+func checkWhat(what string) error {
+	switch what {
+	case "", whatValue, whatNote, whatHyperlink, whatFormattedText, whatAll:
+		return nil
+	}
+	return fmt.Errorf("invalid --what %q: use value, note, hyperlink, formatted-text or all", what)
+}
+
+// cellDetailsFields is the field mask for the grid data read by --what.
+const cellDetailsFields = "sheets(data(rowData(values(" +
+	"formattedValue,note,hyperlink," +
+	"textFormatRuns(startIndex,format(link(uri)))," +
+	"effectiveFormat(numberFormat,backgroundColor)))))"
+
+// cellDetails is everything 'get --what all' reports about a cell.
+type cellDetails struct {
+	Value         string        `json:"value"`
+	Note          string        `json:"note,omitempty"`
+	Hyperlink     string        `json:"hyperlink,omitempty"`
+	Links         []string      `json:"links,omitempty"`
+	FormattedText string        `json:"formatted_text,omitempty"`
+	NumberFormat  *numberFormat `json:"number_format,omitempty"`
+	Background    string        `json:"background,omitempty"`
+}
+
+// numberFormat is the effective number format of a cell.
+type numberFormat struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// fetchCellDetails reads the note, links and format of a plain setting's
+// cell with Spreadsheets.Get and grid data.
+func fetchCellDetails(srv *sheets.Service, c Config) (*cellDetails, error) {
+	if c.Template != "" {
+		return nil, fmt.Errorf("--what is not supported for template settings")
+	}
+	resp, err := srv.Spreadsheets.Get(spreadsheetID(c.Spreadsheet)).
+		Ranges(c.ranges()...).
+		IncludeGridData(true).
+		Fields(cellDetailsFields).
+		Do()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &cellDetails{}
+	if len(resp.Sheets) == 0 || len(resp.Sheets[0].Data) == 0 ||
+		len(resp.Sheets[0].Data[0].RowData) == 0 || len(resp.Sheets[0].Data[0].RowData[0].Values) == 0 {
+		return d, nil
+	}
+	cell := resp.Sheets[0].Data[0].RowData[0].Values[0]
+
+	d.Value = cell.FormattedValue
+	d.Note = cell.Note
+	d.Hyperlink = cell.Hyperlink
+	d.Links, d.FormattedText = textRunLinks(cell.FormattedValue, cell.TextFormatRuns)
+	if f := cell.EffectiveFormat; f != nil {
+		if f.NumberFormat != nil {
+			d.NumberFormat = &numberFormat{Type: f.NumberFormat.Type, Pattern: f.NumberFormat.Pattern}
+		}
+		if f.BackgroundColor != nil {
+			d.Background = colorHex(f.BackgroundColor)
+		}
+	}
+	if d.Hyperlink == "" && len(d.Links) == 1 {
+		d.Hyperlink = d.Links[0]
+	}
+	return d, nil
+}
+
+// textRunLinks collects the links of rich-text runs and renders the text with
+// the linked parts in Markdown link syntax. Run indexes are in UTF-16 code
+// units.
+func textRunLinks(text string, runs []*sheets.TextFormatRun) (links []string, formatted string) {
+	units := utf16.Encode([]rune(text))
+	var b strings.Builder
+	linked := false
+	for i, run := range runs {
+		start := int(run.StartIndex)
+		end := len(units)
+		if i+1 < len(runs) {
+			end = int(runs[i+1].StartIndex)
+		}
+		if start > len(units) || end > len(units) || start > end {
+			continue
+		}
+		part := string(utf16.Decode(units[start:end]))
+		if run.Format != nil && run.Format.Link != nil && run.Format.Link.Uri != "" {
+			links = append(links, run.Format.Link.Uri)
+			fmt.Fprintf(&b, "[%s](%s)", part, run.Format.Link.Uri)
+			linked = true
+			continue
+		}
+		b.WriteString(part)
+	}
+	if !linked {
+		return links, text
+	}
+	// 最初のランより前の文字列も残す
+	if len(runs) > 0 && runs[0].StartIndex > 0 && int(runs[0].StartIndex) <= len(units) {
+		return links, string(utf16.Decode(units[:runs[0].StartIndex])) + b.String()
+	}
+	return links, b.String()
+}
+
+// colorHex formats a color as #RRGGBB. Missing components are zero.
+func colorHex(c *sheets.Color) string {
+	to8 := func(f float64) int { return int(math.Round(f * 255)) }
+	return fmt.Sprintf("#%02X%02X%02X", to8(c.Red), to8(c.Green), to8(c.Blue))
+}
+
+// pick returns the detail selected by --what.
+func (d *cellDetails) pick(what string) (string, error) {
+	switch what {
+	case whatNote:
+		return d.Note, nil
+	case whatHyperlink:
+		if d.Hyperlink != "" {
+			return d.Hyperlink, nil
+		}
+		return strings.Join(d.Links, "\n"), nil
+	case whatFormattedText:
+		return d.FormattedText, nil
+	}
+	if err := checkWhat(what); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("--what %s has no single text to copy", what)
+}
@@ -5,43 +5,34 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/user"
-	"path/filepath"
-	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v2"
 )
 
 var editCmd = &cobra.Command{
-	Use:   "edit [setting_name]",
-	Short: "Edit an existing setting interactively",
-	Args:  cobra.ExactArgs(1),
+	Use:               "edit [setting_name]",
+	Short:             "Edit an existing setting interactively",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeFirstSettingName,
 	Run: func(cmd *cobra.Command, args []string) {
 		settingName := args[0]
 
-		usr, err := user.Current()
+		layers, err := loadConfigLayers()
 		if err != nil {
-			log.Fatalf("Unable to get current user: %v", err)
-		}
-
-		configPath := filepath.Join(usr.HomeDir, ".cell-clip", "config.yml")
-		configData, err := os.ReadFile(configPath)
-		if err != nil {
-			log.Fatalf("Unable to read config file: %v", err)
-		}
-
-		var configs map[string]Config
-		err = yaml.Unmarshal(configData, &configs)
-		if err != nil {
-			log.Fatalf("Unable to parse config file: %v", err)
+			log.Fatalf("Unable to load settings: %v", err)
 		}
+		configs := layers.merged()
 
 		config, ok := configs[settingName]
 		if !ok {
 			log.Fatalf("Setting '%s' not found in config file", settingName)
 		}
+		// 共有ファイルは変更せず、ローカルの設定で上書きする
+		if !layers.isLocal(settingName) {
+			fmt.Printf("'%s' comes from %s; your changes are saved to %s as a local override.\n",
+				settingName, layers.Sources[settingName], layers.Path)
+		}
 
 		reader := bufio.NewReader(os.Stdin)
 
@@ -66,43 +57,70 @@ var editCmd = &cobra.Command{
 			xAxis = config.XAxis
 		}
 
-		fmt.Printf("Row (Y-axis) (current: %d): ", config.YAxis)
+		fmt.Printf("Row (Y-axis) (current: %s): ", config.YAxis)
 		yAxisStr, _ := reader.ReadString('\n')
 		yAxisStr = strings.TrimSpace(yAxisStr)
-		var yAxis int
+		var yAxis Row
 		if yAxisStr == "" {
 			yAxis = config.YAxis
 		} else {
-			yAxis, err = strconv.Atoi(yAxisStr)
+			yAxis, err = parseRow(yAxisStr)
 			if err != nil {
 				log.Fatalf("Invalid input for Row (Y-axis): %v", err)
 			}
 		}
 
-		newConfig := Config{
-			Spreadsheet: spreadsheet,
-			Sheet:       sheet,
-			XAxis:       xAxis,
-			YAxis:       yAxis,
+		fmt.Printf("Description (current: %s): ", config.Description)
+		description, _ := reader.ReadString('\n')
+		description = strings.TrimSpace(description)
+		if description == "" {
+			description = config.Description
 		}
 
-		configs[settingName] = newConfig
+		fmt.Printf("Tags, comma separated (current: %s): ", strings.Join(config.Tags, ","))
+		tagsStr, _ := reader.ReadString('\n')
+		tags := config.Tags
+		if strings.TrimSpace(tagsStr) != "" {
+			tags = parseTags(tagsStr)
+		}
 
-		newData, err := yaml.Marshal(&configs)
-		if err != nil {
-			log.Fatalf("Unable to marshal new config: %v", err)
+		fmt.Printf("Group (current: %s): ", config.Group)
+		group, _ := reader.ReadString('\n')
+		group = strings.TrimSpace(group)
+		if group == "" {
+			group = config.Group
 		}
 
-		configDir := filepath.Dir(configPath)
-		if _, err := os.Stat(configDir); os.IsNotExist(err) {
-			if err := os.MkdirAll(configDir, 0755); err != nil {
-				log.Fatalf("Unable to create config directory: %v", err)
+		// Keep fields that are not edited here, such as the cells of a composite setting.
+		newConfig := config
+		newConfig.Spreadsheet = spreadsheet
+		if spreadsheet != config.Spreadsheet || sheet != config.Sheet {
+			// The stored sheet ID belongs to the old sheet (every spreadsheet has a gid 0).
+			newConfig.SheetID = nil
+		}
+		newConfig.Sheet = sheet
+		if newConfig.SheetID == nil {
+			// 古い設定もここで sheet_id を記録し、名前の変更に追従させる
+			id, err := lookupSheetID(spreadsheet, sheet)
+			if err != nil {
+				fmt.Printf("Unable to record the sheet ID, renames of '%s' will not be followed: %v\n", sheet, err)
 			}
+			newConfig.SheetID = id
 		}
+		newConfig.XAxis = xAxis
+		newConfig.YAxis = yAxis
+		newConfig.Description = description
+		newConfig.Tags = tags
+		newConfig.Group = group
 
-		err = os.WriteFile(configPath, newData, 0644)
+		configs[settingName] = newConfig
+
+		configPath, err := saveConfigs(configs)
 		if err != nil {
-			log.Fatalf("Unable to write to config file: %v", err)
+			log.Fatalf("%v", err)
+		}
+		if _, ok := layers.Project[settingName]; ok {
+			configPath = layers.ProjectPath
 		}
 
 		fmt.Printf("Successfully updated setting '%s' in %s\n", settingName, configPath)
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// bundleVersion is the format version written by 'export'.
+const bundleVersion = 1
+
+var (
+	exportTag    string
+	exportFormat string
+	exportOutput string
+)
+
+// settingsBundle is the portable form of settings exchanged by 'export' and
+// 'import'. It holds setting definitions only: credentials and tokens live in
+// other files, and clipboard fields are dropped because they name local
+// files and commands.
+type settingsBundle struct {
+	Version  int               `yaml:"cell_clip_bundle" json:"cell_clip_bundle"`
+	Settings map[string]Config `yaml:"settings" json:"settings"`
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [setting_name...]",
+	Short: "Export settings as a bundle to share with others",
+	Long: "Write the given settings, the settings with --tag, or all settings as a YAML\n" +
+		"(or --format json) bundle that 'cell-clip import' reads. Bundles never contain\n" +
+		"credentials or tokens, and clipboard fields are left out since they refer to\n" +
+		"local files and commands.",
+	ValidArgsFunction: completeSettingNames,
+	Run: func(cmd *cobra.Command, args []string) {
+		if exportFormat != "yaml" && exportFormat != "json" {
+			log.Fatalf("Invalid format %q: use yaml or json", exportFormat)
+		}
+		configs, err := loadConfigs()
+		if err != nil {
+			log.Fatalf("Unable to load settings: %v", err)
+		}
+		names, missing := selectConfigs(configs, args, len(args) == 0 && exportTag == "", exportTag)
+		if len(missing) > 0 {
+			var unknown []string
+			for name := range missing {
+				unknown = append(unknown, name)
+			}
+			sort.Strings(unknown)
+			log.Fatalf("Settings not found in config file: %s", strings.Join(unknown, ", "))
+		}
+		if len(names) == 0 {
+			log.Fatalf("No settings to export")
+		}
+
+		data, err := marshalBundle(newBundle(configs, names), exportFormat)
+		if err != nil {
+			log.Fatalf("Unable to write bundle: %v", err)
+		}
+		if exportOutput == "" || exportOutput == "-" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(exportOutput, data, 0644); err != nil {
+			log.Fatalf("Unable to write bundle: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d setting(s) to %s\n", len(names), exportOutput)
+	},
+}
+
+// newBundle returns a bundle of the named settings.
+func newBundle(configs map[string]Config, names []string) settingsBundle {
+	b := settingsBundle{Version: bundleVersion, Settings: make(map[string]Config, len(names))}
+	for _, name := range names {
+		c := configs[name]
+		c.Clipboard = ""
+		b.Settings[name] = c
+	}
+	return b
+}
+
+func marshalBundle(b settingsBundle, format string) ([]byte, error) {
+	if format == "json" {
+		data, err := json.MarshalIndent(b, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+	return yaml.Marshal(b)
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportTag, "tag", "", "Export settings with this tag")
+	exportCmd.Flags().StringVar(&exportFormat, "format", "yaml", "Bundle format: yaml or json")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write the bundle to a file instead of stdout")
+	exportCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(
+		[]string{"yaml", "json"}, cobra.ShellCompDirectiveNoFileComp))
+	exportCmd.RegisterFlagCompletionFunc("tag", completeTags)
+	rootCmd.AddCommand(exportCmd)
+}
@@ -1,85 +1,100 @@
 package cmd
 
 import (
-    "bufio"
-    "fmt"
-    "log"
-    "os"
-    "os/user"
-    "path/filepath"
-    "regexp"
-    "sort"
-    "strconv"
-    "strings"
-
-    "github.com/atotto/clipboard"
-    "github.com/spf13/cobra"
-    "google.golang.org/api/sheets/v4"
-    "gopkg.in/yaml.v2"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/api/sheets/v4"
+)
+
+var (
+	getParams []string
+	getAll    bool
+	getTag    string
+	getJSON   bool
+	getJobs   int
+	getSheet  string
+
+	getRender   string
+	getDateTime string
+	getTimezone string
+	getWhat     string
+
+	getNoTransform bool
+	getSensitive   bool
+	getClearAfter  string
+	getClipboard   string
+	getType        bool
 )
 
 var getCmd = &cobra.Command{
-    Use:   "get [setting_name]",
-    Short: "Get a cell value from Google Sheets and copy it to the clipboard",
-    Args:  cobra.MaximumNArgs(1),
-    Run: func(cmd *cobra.Command, args []string) {
-        var settingName string
-        // 設定名が指定されていない場合は対話的に選択
-        if len(args) == 0 {
-            usr, err := user.Current()
-            if err != nil {
-                log.Fatalf("Unable to get current user: %v", err)
-            }
-            configPath := filepath.Join(usr.HomeDir, ".cell-clip", "config.yml")
-            configData, err := os.ReadFile(configPath)
-            if err != nil {
-                log.Fatalf("Unable to read config file: %v", err)
-            }
-            var configs map[string]Config
-            err = yaml.Unmarshal(configData, &configs)
-            if err != nil {
-                log.Fatalf("Unable to parse config file: %v", err)
-            }
-
-            // 名前をソートして表示
-            var names []string
-            for name := range configs {
-                names = append(names, name)
-            }
-            sort.Strings(names)
-            fmt.Println("Select a setting:")
-            for i, n := range names {
-                fmt.Printf("%d) %s\n", i+1, n)
-            }
-            fmt.Print("Enter number or name: ")
-            reader := bufio.NewReader(os.Stdin)
-            input, _ := reader.ReadString('\n')
-            input = strings.TrimSpace(input)
-            // 数字が入力された場合はインデックスに変換
-            if idx, err := strconv.Atoi(input); err == nil && idx >= 1 && idx <= len(names) {
-                settingName = names[idx-1]
-            } else {
-                settingName = input
-            }
-        } else {
-            settingName = args[0]
-        }
-
-		usr, err := user.Current()
+	Use:   "get [setting_name] [args...]",
+	Short: "Get a cell value from Google Sheets and copy it to the clipboard",
+	Long: "Get a cell value from Google Sheets and copy it to the clipboard.\n\n" +
+		"Settings may contain placeholders such as {{.Arg1}} or {{.month}} in any field.\n" +
+		"Positional placeholders are filled from the arguments after the setting name,\n" +
+		"named ones from --param key=value:\n\n" +
+		"  cell-clip get monthly 2026-10 12\n" +
+		"  cell-clip get monthly --param month=2026-10 --param row=12\n\n" +
+		"Composite settings declare several named cells, fetched in one request,\n" +
+		"and render them through a Go template with the helpers trim, upper, lower,\n" +
+		"replace, default and formatNumber.\n\n" +
+		"Several settings can be fetched at once by naming them, or with --all or --tag.\n" +
+		"Settings of the same spreadsheet are read in a single request, and the results\n" +
+		"are printed as a table (or JSON with --json) instead of being copied.\n\n" +
+		"--render selects formatted (default), unformatted or formula values, and\n" +
+		"--date-time iso converts serial dates to ISO-8601 in --timezone. In JSON,\n" +
+		"unformatted numbers are written as numbers.\n\n" +
+		"--what copies the cell's note, hyperlink, or text with rich-text links in\n" +
+		"Markdown form instead of its value; --what all prints them all (with the\n" +
+		"number format and background color) as JSON.\n\n" +
+		"Values are passed through the setting's transforms before they are copied;\n" +
+		"--no-transform shows the raw value.\n\n" +
+		"Values of sensitive settings (or with --sensitive) are masked in the output,\n" +
+		"not cached, and cleared from the clipboard after clear_after (30s by default),\n" +
+		"restoring what was copied before, unless something else was copied meanwhile.\n\n" +
+		"--clipboard (or the setting's clipboard field, or CELL_CLIP_CLIPBOARD) chooses\n" +
+		"where the value goes: system, primary, osc52, tmux, file:PATH or command:CMD.\n" +
+		"The default, auto, uses osc52 when SSH_TTY is set and system otherwise.\n\n" +
+		"--type (or --clipboard type) types the value into the focused window with\n" +
+		"xdotool or wtype instead, after a --countdown to focus it.",
+	Args:              cobra.ArbitraryArgs,
+	ValidArgsFunction: completeGetArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := checkWhat(getWhat); err != nil {
+			log.Fatalf("%v", err)
+		}
+		configs, err := loadConfigs()
 		if err != nil {
-			log.Fatalf("Unable to get current user: %v", err)
+			log.Fatalf("Unable to load settings: %v", err)
 		}
 
-		configPath := filepath.Join(usr.HomeDir, ".cell-clip", "config.yml")
-		configData, err := os.ReadFile(configPath)
-		if err != nil {
-			log.Fatalf("Unable to read config file: %v", err)
+		details := getWhat != "" && getWhat != whatValue
+		multi := len(args) > 1 && configs[args[0]].PositionalArgs() == 0
+		if getAll || getTag != "" || (getJSON && !details) || multi {
+			if details {
+				log.Fatalf("--what %s can only be used with a single setting", getWhat)
+			}
+			runBatchGet(configs, args)
+			return
 		}
 
-		var configs map[string]Config
-		err = yaml.Unmarshal(configData, &configs)
-		if err != nil {
-			log.Fatalf("Unable to parse config file: %v", err)
+		var settingName string
+		// 設定名が指定されていない場合は対話的に選択
+		if len(args) == 0 {
+			settingName, err = pickSetting(configs)
+			if err == errPickerCanceled {
+				return
+			}
+			if err != nil {
+				log.Fatalf("Unable to select a setting: %v", err)
+			}
+		} else {
+			settingName = args[0]
+			args = args[1:]
 		}
 
 		config, ok := configs[settingName]
@@ -87,46 +102,241 @@ var getCmd = &cobra.Command{
 			log.Fatalf("Setting '%s' not found in config file", settingName)
 		}
 
-		oauthManager, err := NewOAuthManager()
+		if n := config.PositionalArgs(); len(args) > n {
+			log.Fatalf("Setting '%s' takes %d argument(s), got %d", settingName, n, len(args))
+		}
+		params, err := parseParams(args, getParams)
 		if err != nil {
-			log.Fatalf("Unable to initialize OAuth manager: %v", err)
+			log.Fatalf("%v", err)
 		}
-
-		client, err := oauthManager.GetAuthenticatedClient()
+		config, err = applyGetFlags(config).Resolve(params)
+		if err != nil {
+			log.Fatalf("Invalid setting '%s': %v", settingName, err)
+		}
+		sink, err := config.sink()
 		if err != nil {
-			log.Fatalf("Unable to get authenticated client: %v", err)
+			log.Fatalf("%v", err)
 		}
 
-		srv, err := sheets.New(client)
+		srv, err := newSheetsService()
 		if err != nil {
-			log.Fatalf("Unable to retrieve Sheets client: %v", err)
+			log.Fatalf("%v", err)
 		}
 
-		readRange := fmt.Sprintf("%s!%s%d", config.Sheet, config.XAxis, config.YAxis)
-		// Extract spreadsheet ID if a full URL is provided.
-		spreadsheetID := config.Spreadsheet
-		if strings.Contains(spreadsheetID, "/d/") {
-			re := regexp.MustCompile(`/d/([^/?#]+)`) // capture characters after /d/ up to '/', '?' or '#'
-			matches := re.FindStringSubmatch(spreadsheetID)
-			if len(matches) > 1 {
-				spreadsheetID = matches[1]
-			}
+		selected := map[string]Config{settingName: config}
+		updates := resolveSheetIDs(srv, selected)
+		config = selected[settingName]
+
+		if details {
+			saveSheetUpdates(updates)
+			runGetDetails(srv, config, sink)
+			return
 		}
-		resp, err := srv.Spreadsheets.Values.Get(spreadsheetID, readRange).Do()
+
+		value, found, err := fetchFollowingRenames(srv, settingName, selected, updates)
 		if err != nil {
 			log.Fatalf("Unable to retrieve data from sheet: %v", err)
 		}
+		config = selected[settingName]
+		cellValue := valueText(value)
+
+		ensureSpreadsheetMeta(srv, spreadsheetID(config.Spreadsheet))
+		saveSheetUpdates(updates)
 
-		if len(resp.Values) == 0 {
+		if !found {
 			fmt.Println("No data found.")
 		} else {
-			cellValue := fmt.Sprintf("%v", resp.Values[0][0])
-			clipboard.WriteAll(cellValue)
-			fmt.Printf("Copied to clipboard: %s\n", cellValue)
+			if !config.Sensitive {
+				cacheValues(map[string]string{settingName: cellValue})
+			}
+			if err := copyValue(config, sink, cellValue); err != nil {
+				log.Fatalf("Unable to copy to clipboard: %v", err)
+			}
 		}
 	},
 }
 
+// runGetDetails copies the note, hyperlink or rich text of a cell, or prints
+// all of its details as JSON.
+func runGetDetails(srv *sheets.Service, config Config, sink clipboardSink) {
+	d, err := fetchCellDetails(srv, config)
+	if err != nil {
+		log.Fatalf("Unable to retrieve data from sheet: %v", err)
+	}
+
+	if getWhat == whatAll || getJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if config.Sensitive {
+			d.Value, d.FormattedText = maskedValue, maskedValue
+		}
+		if getWhat != whatAll {
+			text, err := d.pick(getWhat)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			if err := enc.Encode(map[string]string{getWhat: text}); err != nil {
+				log.Fatalf("Unable to write result: %v", err)
+			}
+			return
+		}
+		if err := enc.Encode(d); err != nil {
+			log.Fatalf("Unable to write result: %v", err)
+		}
+		return
+	}
+
+	text, err := d.pick(getWhat)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if text == "" {
+		fmt.Printf("No %s found.\n", getWhat)
+		return
+	}
+	if err := copyValue(config, sink, text); err != nil {
+		log.Fatalf("Unable to copy to clipboard: %v", err)
+	}
+}
+
+// applyGetFlags overrides the fields of a setting given on the command line.
+func applyGetFlags(c Config) Config {
+	if getSheet != "" {
+		c.Sheet, c.SheetID = getSheet, nil
+	}
+	if getRender != "" {
+		c.Render = getRender
+	}
+	if getDateTime != "" {
+		c.DateTime = getDateTime
+	}
+	if getTimezone != "" {
+		c.Timezone = getTimezone
+	}
+	if getNoTransform {
+		c.Transforms = nil
+	}
+	if getSensitive {
+		c.Sensitive = true
+	}
+	if getClearAfter != "" {
+		c.ClearAfter = getClearAfter
+	}
+	if getClipboard != "" {
+		c.Clipboard = getClipboard
+	}
+	if getType {
+		c.Clipboard = clipboardType
+	}
+	return c
+}
+
+// runBatchGet fetches several settings and prints all results. It exits with
+// a non-zero status if any of them failed.
+func runBatchGet(configs map[string]Config, names []string) {
+	selected, errs := selectConfigs(configs, names, getAll, getTag)
+	if len(selected) == 0 {
+		fmt.Println("No settings selected.")
+		return
+	}
+
+	params, err := parseParams(nil, getParams)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	resolved := make(map[string]Config, len(selected))
+	for _, name := range selected {
+		if errs[name] != nil {
+			continue
+		}
+		c, err := applyGetFlags(configs[name]).Resolve(params)
+		if err != nil {
+			errs[name] = fmt.Errorf("invalid setting: %w", err)
+			continue
+		}
+		resolved[name] = c
+	}
+
+	srv, err := newSheetsService()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	updates := resolveSheetIDs(srv, resolved)
+	results := fetchBatch(srv, selected, resolved, errs, getJobs)
+	// 失敗したものはシート名が古い可能性があるので、名前を更新して読み直す
+	var failed []string
+	for _, r := range results {
+		if r.Error != "" && errs[r.Name] == nil {
+			failed = append(failed, r.Name)
+		}
+	}
+	if renamed := refreshRenamed(srv, resolved, failed, updates); len(renamed) > 0 {
+		retried := make(map[string]getResult)
+		for _, r := range fetchBatch(srv, renamed, resolved, errs, getJobs) {
+			retried[r.Name] = r
+		}
+		for i, r := range results {
+			if rr, ok := retried[r.Name]; ok {
+				results[i] = rr
+			}
+		}
+	}
+	fetched := make(map[string]string)
+	for i, r := range results {
+		if resolved[r.Name].Sensitive {
+			results[i].Sensitive = true
+			continue
+		}
+		if r.Error == "" && r.Found {
+			fetched[r.Name] = r.Text
+		}
+	}
+	cacheValues(fetched)
+	var ids []string
+	for _, c := range resolved {
+		ids = append(ids, spreadsheetID(c.Spreadsheet))
+	}
+	ensureSpreadsheetMeta(srv, ids...)
+	saveSheetUpdates(updates)
+	if err := writeResults(os.Stdout, results, getJSON); err != nil {
+		log.Fatalf("Unable to write results: %v", err)
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			os.Exit(1)
+		}
+	}
+}
+
 func init() {
+	getCmd.Flags().StringArrayVarP(&getParams, "param", "p", nil, "Fill a named placeholder (key=value, repeatable)")
+	getCmd.Flags().BoolVar(&getAll, "all", false, "Get every setting")
+	getCmd.Flags().StringVar(&getTag, "tag", "", "Get every setting with this tag")
+	getCmd.Flags().BoolVar(&getJSON, "json", false, "Print results as JSON instead of copying")
+	getCmd.Flags().IntVarP(&getJobs, "jobs", "j", 4, "Number of spreadsheets fetched concurrently")
+	getCmd.Flags().StringVar(&getSheet, "sheet", "", "Read from this sheet instead of the setting's sheet")
+	getCmd.Flags().StringVar(&getRender, "render", "", "Value render mode: formatted, unformatted or formula")
+	getCmd.Flags().StringVar(&getDateTime, "date-time", "", "Date render mode: formatted, serial or iso")
+	getCmd.Flags().StringVar(&getTimezone, "timezone", "", "Time zone for --date-time iso, e.g. Asia/Tokyo")
+	getCmd.Flags().StringVar(&getWhat, "what", whatValue, "What to copy: value, note, hyperlink, formatted-text or all")
+	getCmd.Flags().BoolVar(&getNoTransform, "no-transform", false, "Copy the value without the setting's transforms")
+	getCmd.Flags().BoolVar(&getSensitive, "sensitive", false, "Mask the value and clear the clipboard after a while")
+	getCmd.Flags().StringVar(&getClearAfter, "clear-after", "", "Clear the clipboard after this long, e.g. 30s (0 keeps the value)")
+	getCmd.Flags().StringVar(&getClipboard, "clipboard", "", "Where to copy: auto, system, primary, osc52, tmux, type, file:PATH or command:CMD")
+	getCmd.Flags().BoolVar(&getType, "type", false, "Type the value into the focused window instead of copying it")
+	getCmd.Flags().DurationVar(&typeDelay, "type-delay", typeDelay, "Delay between typed keystrokes")
+	getCmd.Flags().DurationVar(&typeCountdown, "countdown", typeCountdown, "Time to focus the target window before typing")
+	getCmd.RegisterFlagCompletionFunc("sheet", completeSheetNames)
+	getCmd.RegisterFlagCompletionFunc("clipboard", cobra.FixedCompletions(
+		[]string{clipboardAuto, clipboardSystem, clipboardPrimary, clipboardOSC52, clipboardTmux, clipboardType, clipboardFile, clipboardCommand},
+		cobra.ShellCompDirectiveNoFileComp|cobra.ShellCompDirectiveNoSpace))
+	getCmd.RegisterFlagCompletionFunc("what", cobra.FixedCompletions(
+		[]string{whatValue, whatNote, whatHyperlink, whatFormattedText, whatAll}, cobra.ShellCompDirectiveNoFileComp))
+	getCmd.RegisterFlagCompletionFunc("render", cobra.FixedCompletions(
+		[]string{renderFormatted, renderUnformatted, renderFormula}, cobra.ShellCompDirectiveNoFileComp))
+	getCmd.RegisterFlagCompletionFunc("date-time", cobra.FixedCompletions(
+		[]string{dateTimeFormatted, dateTimeSerial, dateTimeISO}, cobra.ShellCompDirectiveNoFileComp))
+	getCmd.RegisterFlagCompletionFunc("tag", completeTags)
 	rootCmd.AddCommand(getCmd)
 }
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v2"
+)
+
+// Conflict strategies of 'import', for settings whose name is already taken.
+const (
+	importSkip      = "skip"
+	importOverwrite = "overwrite"
+	importRename    = "rename"
+)
+
+var (
+	importStrategy string
+	importSuffix   string
+	importDryRun   bool
+	importYes      bool
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <file|->",
+	Short: "Import settings from a bundle",
+	Long: "Merge the settings of a bundle written by 'cell-clip export' (YAML or JSON, or a\n" +
+		"plain settings snippet as found in config.yml) into your settings. Settings whose\n" +
+		"name is taken are skipped, overwritten, or imported under the name with --suffix\n" +
+		"appended, depending on --strategy. Identical settings are left alone.\n\n" +
+		"The changes are listed and confirmed before they are written; --dry-run only\n" +
+		"lists them. Without a terminal to confirm on (for example when the bundle is\n" +
+		"read from stdin), pass --yes.\n" +
+		"Clipboard fields are never imported, since they can run commands.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		switch importStrategy {
+		case importSkip, importOverwrite, importRename:
+		default:
+			log.Fatalf("Invalid strategy %q: use skip, overwrite or rename", importStrategy)
+		}
+		if importStrategy == importRename && importSuffix == "" {
+			log.Fatalf("--suffix must not be empty")
+		}
+
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			log.Fatalf("Unable to read bundle: %v", err)
+		}
+		incoming, err := parseBundle(data)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		configs, err := loadConfigs()
+		if err != nil {
+			log.Fatalf("Unable to load settings: %v", err)
+		}
+		changes := planImport(configs, incoming, importStrategy, importSuffix)
+		printImport(os.Stdout, changes)
+
+		applied := 0
+		for _, ch := range changes {
+			if ch.Action == importAdd || ch.Action == importUpdate {
+				configs[ch.Target] = ch.Config
+				applied++
+			}
+		}
+		switch {
+		case importDryRun:
+			fmt.Println("Dry run: nothing was written.")
+			return
+		case applied == 0:
+			fmt.Println("Nothing to import.")
+			return
+		case importYes:
+		case !term.IsTerminal(int(os.Stdin.Fd())):
+			log.Fatalf("Cannot confirm the import without a terminal: pass --yes to write the changes")
+		case !confirm(bufio.NewReader(os.Stdin), fmt.Sprintf("Import %d setting(s)?", applied)):
+			fmt.Println("Nothing was written.")
+			return
+		}
+		path, err := saveConfigs(configs)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Printf("Imported %d setting(s) into %s\n", applied, path)
+	},
+}
+
+// parseBundle reads a bundle, or a plain map of settings, in YAML or JSON.
+// Every setting must be well-formed.
+func parseBundle(data []byte) (map[string]Config, error) {
+	var b settingsBundle
+	var settings map[string]Config
+	isJSON := bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+	unmarshal := yaml.Unmarshal
+	if isJSON {
+		unmarshal = json.Unmarshal
+	}
+	if err := unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("unable to parse bundle: %w", err)
+	}
+	switch {
+	case b.Version > bundleVersion:
+		return nil, fmt.Errorf("the bundle has version %d; upgrade cell-clip to import it", b.Version)
+	case b.Version > 0:
+		settings = b.Settings
+	case isJSON:
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("unable to parse bundle: %w", err)
+		}
+	default:
+		// config.yml の一部をそのまま貼り付けたもの（どの版の形式でもよい）
+		f, _, err := decodeConfigFile("bundle", data)
+		if err != nil {
+			return nil, err
+		}
+		settings = f.Settings
+	}
+	if len(settings) == 0 {
+		return nil, fmt.Errorf("the bundle contains no settings")
+	}
+
+	var problems []string
+	for name, c := range settings {
+		if err := c.checkImported(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("invalid settings in bundle:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return settings, nil
+}
+
+// checkImported validates an imported setting as far as possible without
+// its parameters.
+func (c Config) checkImported() error {
+	placeholders := false
+	for _, f := range c.fields() {
+		placeholders = placeholders || strings.Contains(*f, "{{")
+	}
+	for _, ref := range c.Cells {
+		placeholders = placeholders || strings.Contains(ref, "{{")
+	}
+	if !placeholders {
+		c.Clipboard = ""
+		_, err := c.Resolve(nil)
+		return err
+	}
+	if c.Spreadsheet == "" {
+		return fmt.Errorf("spreadsheet is empty")
+	}
+	if err := c.validateRender(); err != nil {
+		return err
+	}
+	return validateTransforms(c.Transforms)
+}
+
+// Actions of an import, as listed in the preview.
+const (
+	importAdd       = "add"
+	importUpdate    = "overwrite"
+	importUnchanged = "unchanged"
+	importSkipped   = "skip"
+)
+
+// importChange is what happens to one setting of a bundle.
+type importChange struct {
+	Name   string
+	Target string
+	Action string
+	Config Config
+	// Fields lists what an overwrite changes.
+	Fields []string
+}
+
+// planImport decides what to do with each incoming setting. Local clipboard
+// fields are kept on overwrite; incoming ones are dropped.
+func planImport(configs, incoming map[string]Config, strategy, suffix string) []importChange {
+	names := make([]string, 0, len(incoming))
+	for name := range incoming {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	taken := make(map[string]bool, len(configs)+len(incoming))
+	for name := range configs {
+		taken[name] = true
+	}
+	for name := range incoming {
+		taken[name] = true
+	}
+
+	changes := make([]importChange, 0, len(names))
+	for _, name := range names {
+		c := incoming[name]
+		c.Clipboard = ""
+		ch := importChange{Name: name, Target: name, Action: importAdd, Config: c}
+		existing, ok := configs[name]
+		if ok {
+			c.Clipboard = existing.Clipboard
+			ch.Config = c
+			ch.Fields = changedFields(existing, c)
+			switch {
+			case len(ch.Fields) == 0:
+				ch.Action = importUnchanged
+			case strategy == importOverwrite:
+				ch.Action = importUpdate
+			case strategy == importRename:
+				ch.Config.Clipboard = ""
+				ch.Target = name + suffix
+				for i := 2; taken[ch.Target]; i++ {
+					ch.Target = fmt.Sprintf("%s%s%d", name, suffix, i)
+				}
+				taken[ch.Target] = true
+			default:
+				ch.Action = importSkipped
+			}
+		}
+		changes = append(changes, ch)
+	}
+	return changes
+}
+
+// changedFields returns the names of the fields that differ between two
+// settings, as written in config.yml.
+func changedFields(a, b Config) []string {
+	fa, fb := configFields(a), configFields(b)
+	var fields []string
+	for k, v := range fa {
+		if w, ok := fb[k]; !ok || !reflect.DeepEqual(v, w) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range fb {
+		if _, ok := fa[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func configFields(c Config) map[string]interface{} {
+	fields := make(map[string]interface{})
+	data, err := yaml.Marshal(c)
+	if err == nil {
+		yaml.Unmarshal(data, &fields)
+	}
+	return fields
+}
+
+// printImport lists the changes of an import.
+func printImport(w io.Writer, changes []importChange) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, ch := range changes {
+		mark, detail := "+", "new"
+		switch {
+		case ch.Action == importUpdate:
+			mark, detail = "~", "overwrite: "+strings.Join(ch.Fields, ", ")
+		case ch.Action == importUnchanged:
+			mark, detail = "=", "unchanged"
+		case ch.Action == importSkipped:
+			mark, detail = "!", "skipped: name taken, differs in "+strings.Join(ch.Fields, ", ")
+		case ch.Target != ch.Name:
+			detail = "renamed from " + ch.Name + ": name taken"
+		}
+		fmt.Fprintf(tw, "%s %s\t%s\n", mark, ch.Target, detail)
+	}
+	tw.Flush()
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importStrategy, "strategy", importSkip, "What to do with settings whose name is taken: skip, overwrite or rename")
+	importCmd.Flags().StringVar(&importSuffix, "suffix", "-imported", "Suffix of renamed settings with --strategy rename")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Only list the changes")
+	importCmd.Flags().BoolVarP(&importYes, "yes", "y", false, "Write the changes without asking")
+	importCmd.RegisterFlagCompletionFunc("strategy", cobra.FixedCompletions(
+		[]string{importSkip, importOverwrite, importRename}, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.AddCommand(importCmd)
+}
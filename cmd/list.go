@@ -1,56 +1,131 @@
 package cmd
 
 import (
-    "fmt"
-    "log"
-    "os"
-    "os/user"
-    "path/filepath"
-    "sort"
-
-    "github.com/spf13/cobra"
-    "gopkg.in/yaml.v2"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	listTag   string
+	listGroup string
+	listLong  bool
+	listJSON  bool
+	listYAML  bool
 )
 
+// listEntry is a setting as printed by 'list --json'.
+type listEntry struct {
+	Name string `json:"name"`
+	Config
+	// Source is the file the setting is read from.
+	Source string `json:"source,omitempty"`
+}
+
 var listCmd = &cobra.Command{
-	Use:   "list",
+	Use:   "list [filter]",
 	Short: "List all registered setting names",
+	Long: "List all registered setting names.\n\n" +
+		"The optional filter keeps settings whose name or description contains it,\n" +
+		"ignoring case. Use --long for details, or --json/--yaml for scripts.",
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		usr, err := user.Current()
+		layers, err := loadConfigLayers()
 		if err != nil {
-			log.Fatalf("Unable to get current user: %v", err)
+			log.Fatalf("Unable to load settings: %v", err)
 		}
+		configs := layers.merged()
 
-		configPath := filepath.Join(usr.HomeDir, ".cell-clip", "config.yml")
-		configData, err := os.ReadFile(configPath)
-		if err != nil {
-			if os.IsNotExist(err) {
-				fmt.Println("No settings found.")
-				return
+		filter := ""
+		if len(args) > 0 {
+			filter = strings.ToLower(args[0])
+		}
+
+		// ソートされた名前のリストを表示
+		var names []string
+		for name, c := range configs {
+			if listTag != "" && !c.HasTag(listTag) {
+				continue
+			}
+			if listGroup != "" && c.Group != listGroup {
+				continue
 			}
-			log.Fatalf("Unable to read config file: %v", err)
+			if filter != "" && !strings.Contains(strings.ToLower(name), filter) &&
+				!strings.Contains(strings.ToLower(c.Description), filter) {
+				continue
+			}
+			names = append(names, name)
 		}
+		sort.Strings(names)
 
-		var configs map[string]Config
-		err = yaml.Unmarshal(configData, &configs)
-		if err != nil {
-			log.Fatalf("Unable to parse config file: %v", err)
+		switch {
+		case listJSON:
+			entries := make([]listEntry, 0, len(names))
+			for _, name := range names {
+				entries = append(entries, listEntry{Name: name, Config: configs[name], Source: layers.source(name)})
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(entries); err != nil {
+				log.Fatalf("Unable to write settings: %v", err)
+			}
+			return
+		case listYAML:
+			selected := make(map[string]Config, len(names))
+			for _, name := range names {
+				selected[name] = configs[name]
+			}
+			data, err := yaml.Marshal(selected)
+			if err != nil {
+				log.Fatalf("Unable to write settings: %v", err)
+			}
+			os.Stdout.Write(data)
+			return
+		}
+
+		if len(names) == 0 {
+			fmt.Println("No settings found.")
+			return
 		}
 
-        // ソートされた名前のリストを表示
-        var names []string
-        for name := range configs {
-            names = append(names, name)
-        }
-        sort.Strings(names)
-
-        fmt.Println("Registered setting names:")
-        for _, name := range names {
-            fmt.Println("- ", name)
-        }
+		if listLong {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tGROUP\tSPREADSHEET\tSHEET\tCELL\tTAGS\tSOURCE\tDESCRIPTION")
+			for _, name := range names {
+				c := configs[name]
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, c.Group, spreadsheetID(c.Spreadsheet),
+					c.Sheet, c.cellLabel(), strings.Join(c.Tags, ","), layers.source(name), c.Description)
+			}
+			tw.Flush()
+			return
+		}
+
+		fmt.Println("Registered setting names:")
+		for _, name := range names {
+			if layers.Sources[name] == layers.Path {
+				fmt.Println("- ", name)
+			} else {
+				fmt.Println("- ", name, "("+layers.source(name)+")")
+			}
+		}
 	},
 }
 
 func init() {
+	listCmd.Flags().StringVar(&listTag, "tag", "", "Only list settings with this tag")
+	listCmd.Flags().StringVar(&listGroup, "group", "", "Only list settings in this group")
+	listCmd.Flags().BoolVarP(&listLong, "long", "l", false, "Show spreadsheet, sheet, cell and description")
+	listCmd.Flags().BoolVar(&listJSON, "json", false, "Print settings as JSON")
+	listCmd.Flags().BoolVar(&listYAML, "yaml", false, "Print settings as YAML")
+	listCmd.MarkFlagsMutuallyExclusive("json", "yaml", "long")
+	listCmd.RegisterFlagCompletionFunc("tag", completeTags)
+	listCmd.RegisterFlagCompletionFunc("group", completeGroups)
 	rootCmd.AddCommand(listCmd)
 }
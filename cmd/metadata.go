@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// sheetMeta describes one tab of a spreadsheet.
+type sheetMeta struct {
+	Title   string `json:"title"`
+	SheetID int64  `json:"sheet_id"`
+	Rows    int64  `json:"rows"`
+	Columns int64  `json:"columns"`
+}
+
+// spreadsheetMeta is the cached structure of a spreadsheet.
+type spreadsheetMeta struct {
+	Title     string      `json:"title"`
+	Sheets    []sheetMeta `json:"sheets"`
+	FetchedAt time.Time   `json:"fetched_at"`
+}
+
+// sheetTitles returns the titles of all tabs.
+func (m *spreadsheetMeta) sheetTitles() []string {
+	titles := make([]string, 0, len(m.Sheets))
+	for _, s := range m.Sheets {
+		titles = append(titles, s.Title)
+	}
+	return titles
+}
+
+// metaCachePath returns the path of the spreadsheet metadata cache.
+func metaCachePath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cache", "spreadsheets.json"), nil
+}
+
+// loadMetaCache reads the metadata cache, keyed by spreadsheet ID. Any error
+// yields an empty cache.
+func loadMetaCache() map[string]*spreadsheetMeta {
+	cache := make(map[string]*spreadsheetMeta)
+	path, err := metaCachePath()
+	if err != nil {
+		return cache
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	_ = json.Unmarshal(data, &cache)
+	return cache
+}
+
+// cachedSpreadsheetMeta returns the cached metadata of a spreadsheet.
+func cachedSpreadsheetMeta(id string) (*spreadsheetMeta, bool) {
+	m, ok := loadMetaCache()[id]
+	return m, ok && m != nil
+}
+
+// storeSpreadsheetMeta records metadata in the cache. Errors are ignored
+// since the cache is best effort.
+func storeSpreadsheetMeta(id string, meta *spreadsheetMeta) {
+	path, err := metaCachePath()
+	if err != nil {
+		return
+	}
+	cache := loadMetaCache()
+	cache[id] = meta
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, data, 0600)
+}
+
+// fetchSpreadsheetMeta reads the title and tabs of a spreadsheet and
+// refreshes the cache. The daemon may answer with metadata up to
+// daemonMetaTTL old; see refreshSpreadsheetMeta.
+func fetchSpreadsheetMeta(srv *sheets.Service, id string) (*spreadsheetMeta, error) {
+	return readSpreadsheetMeta(srv, id, false)
+}
+
+// refreshSpreadsheetMeta is fetchSpreadsheetMeta for callers that need the
+// current tabs, such as after a rename: the daemon's copy is bypassed.
+func refreshSpreadsheetMeta(srv *sheets.Service, id string) (*spreadsheetMeta, error) {
+	return readSpreadsheetMeta(srv, id, true)
+}
+
+func readSpreadsheetMeta(srv *sheets.Service, id string, fresh bool) (*spreadsheetMeta, error) {
+	call := srv.Spreadsheets.Get(id).
+		Fields("properties.title,sheets.properties(sheetId,title,gridProperties(rowCount,columnCount))")
+	if fresh {
+		call.Header().Set("Cache-Control", "no-cache")
+	}
+	resp, err := call.Do()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &spreadsheetMeta{FetchedAt: time.Now()}
+	if resp.Properties != nil {
+		meta.Title = resp.Properties.Title
+	}
+	for _, s := range resp.Sheets {
+		if s.Properties == nil {
+			continue
+		}
+		sm := sheetMeta{Title: s.Properties.Title, SheetID: s.Properties.SheetId}
+		if g := s.Properties.GridProperties; g != nil {
+			sm.Rows, sm.Columns = g.RowCount, g.ColumnCount
+		}
+		meta.Sheets = append(meta.Sheets, sm)
+	}
+	storeSpreadsheetMeta(id, meta)
+	return meta, nil
+}
+
+// ensureSpreadsheetMeta caches the metadata of spreadsheets that have not
+// been seen yet, so that completion can offer their sheet names. Failures
+// are ignored.
+func ensureSpreadsheetMeta(srv *sheets.Service, ids ...string) {
+	cache := loadMetaCache()
+	for _, id := range ids {
+		if _, ok := cache[id]; ok {
+			continue
+		}
+		_, _ = fetchSpreadsheetMeta(srv, id)
+	}
+}
+
+// sheetByID returns the tab with the given sheet ID (gid).
+func (m *spreadsheetMeta) sheetByID(id int64) *sheetMeta {
+	for i := range m.Sheets {
+		if m.Sheets[i].SheetID == id {
+			return &m.Sheets[i]
+		}
+	}
+	return nil
+}
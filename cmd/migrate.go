@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configVersion is the layout version of settings files written by this
+// build. Files without a version key are version 1.
+const configVersion = 2
+
+// configMigration upgrades a settings file from version From to From+1. It
+// works on the raw document, so that it can move and rename anything.
+type configMigration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]interface{}) (map[string]interface{}, error)
+}
+
+// configMigrations are applied in order to files older than configVersion.
+var configMigrations = []configMigration{
+	{
+		// Version 1 kept settings at the top level, where every new key
+		// could clash with a setting name.
+		From:        1,
+		Description: "move settings under settings:",
+		Apply: func(doc map[string]interface{}) (map[string]interface{}, error) {
+			settings := make(map[string]interface{})
+			upgraded := map[string]interface{}{"settings": settings}
+			for key, v := range doc {
+				if key == includeKey {
+					upgraded[key] = v
+					continue
+				}
+				settings[key] = v
+			}
+			return upgraded, nil
+		},
+	},
+}
+
+// decodeConfigFile parses a settings file of any supported version and
+// returns it in the current layout, along with the version it was written
+// in. path is only used in messages.
+func decodeConfigFile(path string, data []byte) (configFile, int, error) {
+	var f configFile
+	doc := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return f, 0, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+
+	version := 1
+	if v, ok := doc["version"]; ok {
+		switch v := v.(type) {
+		case int:
+			version = v
+			delete(doc, "version")
+		case map[interface{}]interface{}:
+			// 旧形式で "version" という名前の設定
+		default:
+			return f, 0, fmt.Errorf("invalid config file %s: version must be a number", path)
+		}
+	}
+	if version > configVersion {
+		return f, 0, fmt.Errorf("config file %s has version %d, but this cell-clip only reads up to version %d: please upgrade cell-clip",
+			path, version, configVersion)
+	}
+	if version < 1 {
+		return f, 0, fmt.Errorf("invalid config file %s: unknown version %d", path, version)
+	}
+
+	for _, m := range configMigrations[version-1:] {
+		var err error
+		if doc, err = m.Apply(doc); err != nil {
+			return f, 0, fmt.Errorf("unable to upgrade config file %s from version %d (%s): %w", path, m.From, m.Description, err)
+		}
+	}
+
+	upgraded, err := yaml.Marshal(doc)
+	if err != nil {
+		return f, 0, fmt.Errorf("unable to upgrade config file %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(upgraded, &f); err != nil {
+		return f, 0, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+	f.Version = configVersion
+	return f, version, nil
+}
+
+// upgradeConfigFile rewrites an old settings file in the current layout,
+// keeping the original next to it, and returns the backup's path.
+func upgradeConfigFile(path string, f configFile, from int) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	// 既存のバックアップは上書きしない
+	base := fmt.Sprintf("%s.v%d-%s", path, from, time.Now().Format("20060102-150405"))
+	backup := base + ".bak"
+	for i := 2; ; i++ {
+		err := writeNewFile(backup, data)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("unable to back up %s: %w", path, err)
+		}
+		backup = fmt.Sprintf("%s-%d.bak", base, i)
+	}
+	if err := writeConfigFile(path, f); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// writeNewFile writes data to a file that must not exist yet.
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -5,18 +5,37 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/user"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v2"
+	"google.golang.org/api/sheets/v4"
+)
+
+var (
+	newNoBrowse bool
+	newFromURL  string
+	newLocal    bool
+)
+
+// previewRows and previewCols are the size of the grid shown by 'new'.
+const (
+	previewRows = 8
+	previewCols = 6
 )
 
 var newCmd = &cobra.Command{
 	Use:   "new",
 	Short: "Add a new setting interactively",
+	Long: "Add a new setting interactively.\n\n" +
+		"After the spreadsheet is entered, its sheets are listed to choose from, a preview\n" +
+		"of the top-left of the chosen sheet is shown, and the cell is checked and its\n" +
+		"current value displayed before saving. Use --no-browse to type everything blind.\n\n" +
+		"A link from \"Get link to this cell\" (…/d/ID/edit#gid=123&range=B7) fills in the\n" +
+		"sheet and cell as well; pass it at the prompt or with --from-url.\n\n" +
+		"With --local the setting is saved to the project's .cell-clip.yml, the nearest\n" +
+		"one in the working directory or its parents, or a new one in the working directory.",
 	Run: func(cmd *cobra.Command, args []string) {
 		reader := bufio.NewReader(os.Stdin)
 
@@ -24,76 +43,276 @@ var newCmd = &cobra.Command{
 		settingName, _ := reader.ReadString('\n')
 		settingName = strings.TrimSpace(settingName)
 
-		fmt.Print("Spreadsheet URL or ID: ")
-		spreadsheet, _ := reader.ReadString('\n')
-		spreadsheet = strings.TrimSpace(spreadsheet)
+		spreadsheet := newFromURL
+		if spreadsheet == "" {
+			fmt.Print("Spreadsheet URL or ID: ")
+			spreadsheet, _ = reader.ReadString('\n')
+			spreadsheet = strings.TrimSpace(spreadsheet)
+		}
 
-		fmt.Print("Sheet name: ")
-		sheet, _ := reader.ReadString('\n')
-		sheet = strings.TrimSpace(sheet)
+		// A link to a cell also carries the sheet (gid) and the cell (range).
+		var link sheetLink
+		if !strings.Contains(spreadsheet, "{{") {
+			var err error
+			link, err = parseSheetURL(spreadsheet)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			if link.HasGID || link.Range != "" {
+				spreadsheet = link.ID
+			}
+		}
 
-		fmt.Print("Column (X-axis): ")
-		xAxis, _ := reader.ReadString('\n')
-		xAxis = strings.TrimSpace(xAxis)
+		var srv *sheets.Service
+		var meta *spreadsheetMeta
+		if !newNoBrowse && !strings.Contains(spreadsheet, "{{") {
+			var err error
+			srv, meta, err = browseSpreadsheet(link.ID)
+			if err != nil {
+				fmt.Printf("Unable to read the spreadsheet, continuing without checks: %v\n", err)
+			}
+		}
 
-		fmt.Print("Row (Y-axis): ")
-		yAxisStr, _ := reader.ReadString('\n')
-		yAxis, err := strconv.Atoi(strings.TrimSpace(yAxisStr))
-		if err != nil {
-			log.Fatalf("Invalid input for Row (Y-axis): %v", err)
+		var sheet string
+		if meta != nil && link.HasGID {
+			if s := meta.sheetByID(link.GID); s != nil {
+				sheet = s.Title
+				fmt.Printf("Sheet: %s\n", sheet)
+			} else {
+				fmt.Printf("No sheet with gid %d found.\n", link.GID)
+			}
+		}
+		if sheet == "" {
+			if meta != nil {
+				sheet = promptSheet(reader, meta)
+			} else {
+				fmt.Print("Sheet name: ")
+				sheet, _ = reader.ReadString('\n')
+				sheet = strings.TrimSpace(sheet)
+			}
 		}
 
+		var sheetID *int64
+		if meta != nil {
+			if s := findSheet(meta, sheet); s != nil {
+				id := s.SheetID
+				sheetID = &id
+			}
+		}
+
+		// 範囲の左上のセルを初期値にする
+		xAxis, row := splitCell(strings.SplitN(link.Range, ":", 2)[0])
+		yAxis := Row(strconv.Itoa(row))
+		prefilled := row > 0 && columnRe.MatchString(xAxis)
+		if prefilled {
+			fmt.Printf("Cell: %s%s\n", xAxis, yAxis)
+		} else if meta != nil {
+			printPreview(srv, link.ID, sheet)
+		}
+
+		for {
+			if !prefilled {
+				fmt.Print("Column (X-axis): ")
+				xAxis, _ = reader.ReadString('\n')
+				xAxis = strings.TrimSpace(xAxis)
+
+				fmt.Print("Row (Y-axis): ")
+				yAxisStr, _ := reader.ReadString('\n')
+				var err error
+				yAxis, err = parseRow(yAxisStr)
+				if err != nil {
+					log.Fatalf("Invalid input for Row (Y-axis): %v", err)
+				}
+			}
+
+			if meta == nil {
+				break
+			}
+			checked, ok := checkNewCell(srv, spreadsheet, sheet, xAxis, yAxis, meta)
+			if !checked {
+				break
+			}
+			// 問題のあるセルは Enter だけでは保存しない
+			use := confirm
+			if !ok {
+				use = confirmNo
+			}
+			if !use(reader, "Use this cell?") {
+				if prefilled {
+					prefilled = false
+					printPreview(srv, link.ID, sheet)
+				}
+				continue
+			}
+			break
+		}
+
+		fmt.Print("Description (optional): ")
+		description, _ := reader.ReadString('\n')
+
+		fmt.Print("Tags, comma separated (optional): ")
+		tags, _ := reader.ReadString('\n')
+
+		fmt.Print("Group (optional): ")
+		group, _ := reader.ReadString('\n')
+
 		newConfig := Config{
 			Spreadsheet: spreadsheet,
 			Sheet:       sheet,
+			SheetID:     sheetID,
 			XAxis:       xAxis,
 			YAxis:       yAxis,
+			Description: strings.TrimSpace(description),
+			Tags:        parseTags(tags),
+			Group:       strings.TrimSpace(group),
 		}
 
-		usr, err := user.Current()
-		if err != nil {
-			log.Fatalf("Unable to get current user: %v", err)
-		}
-
-		configPath := filepath.Join(usr.HomeDir, ".cell-clip", "config.yml")
-		configData, err := os.ReadFile(configPath)
-		if err != nil && !os.IsNotExist(err) {
-			log.Fatalf("Unable to read config file: %v", err)
-		}
-
-		var configs map[string]Config
-		if len(configData) > 0 {
-			err = yaml.Unmarshal(configData, &configs)
+		var configPath string
+		var err error
+		if newLocal {
+			configPath, err = saveProjectSetting(settingName, newConfig)
+		} else {
+			var configs map[string]Config
+			configs, err = loadConfigs()
 			if err != nil {
-				log.Fatalf("Unable to parse config file: %v", err)
+				log.Fatalf("Unable to load settings: %v", err)
 			}
-		} else {
-			configs = make(map[string]Config)
+			configs[settingName] = newConfig
+			configPath, err = saveConfigs(configs)
+		}
+		if err != nil {
+			log.Fatalf("%v", err)
 		}
 
-		configs[settingName] = newConfig
+		fmt.Printf("Successfully added setting '%s' to %s\n", settingName, configPath)
+	},
+}
+
+// browseSpreadsheet connects to the API and reads the spreadsheet's tabs.
+func browseSpreadsheet(id string) (*sheets.Service, *spreadsheetMeta, error) {
+	srv, err := newSheetsService()
+	if err != nil {
+		return nil, nil, err
+	}
+	meta, err := refreshSpreadsheetMeta(srv, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s", describeAccessError(err))
+	}
+	if len(meta.Sheets) == 0 {
+		return nil, nil, fmt.Errorf("spreadsheet has no sheets")
+	}
+	return srv, meta, nil
+}
 
-		newData, err := yaml.Marshal(&configs)
+// promptSheet lists the sheets of a spreadsheet and reads a number or a name
+// until an existing sheet is chosen.
+func promptSheet(reader *bufio.Reader, meta *spreadsheetMeta) string {
+	fmt.Printf("Sheets in '%s':\n", meta.Title)
+	for i, s := range meta.Sheets {
+		fmt.Printf("%d) %s\n", i+1, s.Title)
+	}
+	for {
+		fmt.Print("Sheet (number or name): ")
+		input, err := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		if idx, err := strconv.Atoi(input); err == nil && idx >= 1 && idx <= len(meta.Sheets) {
+			return meta.Sheets[idx-1].Title
+		}
+		if findSheet(meta, input) != nil {
+			return input
+		}
 		if err != nil {
-			log.Fatalf("Unable to marshal new config: %v", err)
+			log.Fatalf("No sheet selected")
+		}
+		fmt.Printf("Sheet %q not found", input)
+		if s := closestString(input, meta.sheetTitles()); s != "" {
+			fmt.Printf(" (did you mean %q?)", s)
 		}
+		fmt.Println()
+	}
+}
+
+// printPreview shows the top-left corner of a sheet with row and column
+// labels. Errors are reported but not fatal.
+func printPreview(srv *sheets.Service, id, sheet string) {
+	readRange := fmt.Sprintf("%s!A1:%s%d", quoteSheet(sheet), columnName(previewCols), previewRows)
+	resp, err := srv.Spreadsheets.Values.Get(id, readRange).Do()
+	if err != nil {
+		fmt.Printf("Unable to preview sheet: %v\n", err)
+		return
+	}
 
-		configDir := filepath.Dir(configPath)
-		if _, err := os.Stat(configDir); os.IsNotExist(err) {
-			if err := os.MkdirAll(configDir, 0755); err != nil {
-				log.Fatalf("Unable to create config directory: %v", err)
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "\t")
+	for c := 1; c <= previewCols; c++ {
+		fmt.Fprintf(tw, "%s\t", columnName(c))
+	}
+	fmt.Fprintln(tw)
+	for r := 0; r < previewRows; r++ {
+		fmt.Fprintf(tw, "%d\t", r+1)
+		for c := 0; c < previewCols; c++ {
+			v := ""
+			if r < len(resp.Values) && c < len(resp.Values[r]) {
+				v = truncate(strings.ReplaceAll(fmt.Sprintf("%v", resp.Values[r][c]), "\n", " "), 14)
 			}
+			fmt.Fprintf(tw, "%s\t", v)
 		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	fmt.Println()
+}
 
-		err = os.WriteFile(configPath, newData, 0644)
-		if err != nil {
-			log.Fatalf("Unable to write to config file: %v", err)
-		}
+// checkNewCell checks that the chosen cell exists and shows its current
+// value. checked is false when the cell could not be checked, e.g. because
+// it contains a placeholder; ok is false when a check failed.
+func checkNewCell(srv *sheets.Service, spreadsheet, sheet, xAxis string, yAxis Row, meta *spreadsheetMeta) (checked, ok bool) {
+	c := Config{Spreadsheet: spreadsheet, Sheet: sheet, XAxis: xAxis, YAxis: yAxis}
+	if c.PositionalArgs() > 0 || strings.Contains(string(yAxis), "{{") || strings.Contains(xAxis, "{{") {
+		return false, false
+	}
+	if err := c.validate(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return true, false
+	}
+	if status, detail := checkSetting(c, meta); status != statusOK {
+		fmt.Printf("Warning: %s\n", detail)
+		return true, false
+	}
 
-		fmt.Printf("Successfully added setting '%s' to %s\n", settingName, configPath)
-	},
+	value, found, err := fetchSetting(srv, c)
+	switch {
+	case err != nil:
+		fmt.Printf("Unable to read %s%s: %v\n", xAxis, yAxis, err)
+		return true, false
+	case !found:
+		fmt.Printf("Cell %s%s is currently empty.\n", xAxis, yAxis)
+	default:
+		fmt.Printf("Current value of %s%s: %s\n", xAxis, yAxis, valueText(value))
+	}
+	return true, true
+}
+
+// confirm asks a yes/no question, defaulting to yes.
+func confirm(reader *bufio.Reader, question string) bool {
+	fmt.Printf("%s [Y/n]: ", question)
+	answer, _ := reader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// confirmNo asks a yes/no question, defaulting to no.
+func confirmNo(reader *bufio.Reader, question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, _ := reader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
 func init() {
+	newCmd.Flags().StringVar(&newFromURL, "from-url", "", "Pre-fill the setting from a spreadsheet or cell link")
+	newCmd.Flags().BoolVar(&newLocal, "local", false, "Save the setting to the project's .cell-clip.yml instead of config.yml")
+	newCmd.Flags().BoolVar(&newNoBrowse, "no-browse", false, "Do not read the spreadsheet while creating the setting")
 	rootCmd.AddCommand(newCmd)
 }
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxOSC52 is the largest base64 payload sent with OSC 52. Terminals drop
+// longer sequences silently (xterm, hterm and others stop at about 100 kB),
+// so larger values are refused with an error instead.
+const maxOSC52 = 100000
+
+// screenChunk is the size of the pieces GNU screen passes through; it cuts
+// longer DCS strings.
+const screenChunk = 76
+
+// writeOSC52 copies text to the clipboard of the terminal the user is sitting
+// at, which works over SSH. The sequence is written to the controlling
+// terminal so that redirected output is not polluted.
+func writeOSC52(text string) error {
+	payload := base64.StdEncoding.EncodeToString([]byte(text))
+	if len(payload) > maxOSC52 {
+		return fmt.Errorf("value is too large for OSC 52 (%d bytes encoded, limit %d)", len(payload), maxOSC52)
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("no terminal to send OSC 52 to: %w", err)
+	}
+	defer tty.Close()
+	return writeOSC52To(tty, payload, os.Getenv("TMUX") != "", strings.HasPrefix(os.Getenv("TERM"), "screen"))
+}
+
+// writeOSC52To writes the OSC 52 sequence for a base64 payload, wrapped for
+// tmux or GNU screen passthrough when running inside them.
+func writeOSC52To(w io.Writer, payload string, tmux, screen bool) error {
+	seq := "\x1b]52;c;" + payload + "\a"
+	switch {
+	case tmux:
+		// tmux はエスケープを二重にして DCS で包む必要がある (allow-passthrough on)
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	case screen:
+		var b strings.Builder
+		for len(seq) > 0 {
+			n := min(screenChunk, len(seq))
+			b.WriteString("\x1bP" + seq[:n] + "\x1b\\")
+			seq = seq[n:]
+		}
+		seq = b.String()
+	}
+	_, err := io.WriteString(w, seq)
+	return err
+}
@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// errPickerCanceled is returned when the user leaves the picker without
+// choosing a setting.
+var errPickerCanceled = fmt.Errorf("no setting selected")
+
+// pickSetting lets the user choose a setting. A full-screen fuzzy finder is
+// used on a terminal, and a numbered prompt otherwise.
+func pickSetting(configs map[string]Config) (string, error) {
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return promptSetting(names)
+	}
+
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return promptSetting(names)
+	}
+	defer term.Restore(in, state)
+
+	p := &picker{names: names, configs: configs, cache: loadValueCache()}
+	// 代替スクリーンを使い、終了時に元の画面へ戻す
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+	return p.run(os.Stdin, os.Stdout, out)
+}
+
+// promptSetting prints a numbered list and reads a number or a name.
+func promptSetting(names []string) (string, error) {
+	fmt.Println("Select a setting:")
+	for i, n := range names {
+		fmt.Printf("%d) %s\n", i+1, n)
+	}
+	fmt.Print("Enter number or name: ")
+	reader := bufio.NewReader(os.Stdin)
+	input, _ := reader.ReadString('\n')
+	input = strings.TrimSpace(input)
+	// 数字が入力された場合はインデックスに変換
+	if idx, err := strconv.Atoi(input); err == nil && idx >= 1 && idx <= len(names) {
+		return names[idx-1], nil
+	}
+	if input == "" {
+		return "", errPickerCanceled
+	}
+	return input, nil
+}
+
+// picker is the state of the fuzzy finder.
+type picker struct {
+	names   []string
+	configs map[string]Config
+	cache   map[string]cachedValue
+
+	query    []rune
+	matches  []string
+	selected int
+	offset   int
+}
+
+type pickerKey int
+
+const (
+	keyRune pickerKey = iota
+	keyEnter
+	keyCancel
+	keyBackspace
+	keyUp
+	keyDown
+	keyClear
+)
+
+// run handles input until a setting is chosen or the picker is canceled.
+// fd is the terminal used to query the window size.
+func (p *picker) run(r io.Reader, w io.Writer, fd int) (string, error) {
+	p.filter()
+	buf := make([]byte, 64)
+	for {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		p.render(w, width, height)
+
+		n, err := r.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		for _, ev := range parseKeys(buf[:n]) {
+			switch ev.key {
+			case keyEnter:
+				if len(p.matches) == 0 {
+					continue
+				}
+				return p.matches[p.selected], nil
+			case keyCancel:
+				return "", errPickerCanceled
+			case keyBackspace:
+				if len(p.query) > 0 {
+					p.query = p.query[:len(p.query)-1]
+					p.filter()
+				}
+			case keyClear:
+				p.query = nil
+				p.filter()
+			case keyUp:
+				if p.selected > 0 {
+					p.selected--
+				}
+			case keyDown:
+				if p.selected < len(p.matches)-1 {
+					p.selected++
+				}
+			case keyRune:
+				p.query = append(p.query, ev.r)
+				p.filter()
+			}
+		}
+	}
+}
+
+type keyEvent struct {
+	key pickerKey
+	r   rune
+}
+
+// parseKeys decodes raw terminal input into key events.
+func parseKeys(b []byte) []keyEvent {
+	var events []keyEvent
+	for len(b) > 0 {
+		switch {
+		case b[0] == '\r' || b[0] == '\n':
+			events = append(events, keyEvent{key: keyEnter})
+			b = b[1:]
+		case b[0] == 3 || (b[0] == 27 && len(b) == 1):
+			// Ctrl-C, or a lone Esc
+			events = append(events, keyEvent{key: keyCancel})
+			b = b[1:]
+		case b[0] == 127 || b[0] == 8:
+			events = append(events, keyEvent{key: keyBackspace})
+			b = b[1:]
+		case b[0] == 21:
+			// Ctrl-U
+			events = append(events, keyEvent{key: keyClear})
+			b = b[1:]
+		case b[0] == 16 || b[0] == 11:
+			// Ctrl-P, Ctrl-K
+			events = append(events, keyEvent{key: keyUp})
+			b = b[1:]
+		case b[0] == 14:
+			// Ctrl-N
+			events = append(events, keyEvent{key: keyDown})
+			b = b[1:]
+		case b[0] == 27 && len(b) >= 3 && (b[1] == '[' || b[1] == 'O'):
+			switch b[2] {
+			case 'A':
+				events = append(events, keyEvent{key: keyUp})
+			case 'B':
+				events = append(events, keyEvent{key: keyDown})
+			}
+			b = b[3:]
+		case b[0] < 32 || b[0] == 27:
+			b = b[1:]
+		default:
+			r, size := utf8.DecodeRune(b)
+			if unicode.IsPrint(r) {
+				events = append(events, keyEvent{key: keyRune, r: r})
+			}
+			b = b[size:]
+		}
+	}
+	return events
+}
+
+// filter recomputes the matches for the current query.
+func (p *picker) filter() {
+	type scored struct {
+		name  string
+		score int
+	}
+	var found []scored
+	for _, name := range p.names {
+		if s, ok := fuzzyScore(name, string(p.query)); ok {
+			found = append(found, scored{name, s})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].score > found[j].score })
+
+	p.matches = p.matches[:0]
+	for _, f := range found {
+		p.matches = append(p.matches, f.name)
+	}
+	p.selected, p.offset = 0, 0
+}
+
+// fuzzyScore reports whether all runes of query appear in name in order,
+// ignoring case. Consecutive runes and matches at word starts score higher.
+func fuzzyScore(name, query string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+	n := []rune(strings.ToLower(name))
+	q := []rune(strings.ToLower(query))
+	score, qi, last := 0, 0, -2
+	for i, r := range n {
+		if qi == len(q) {
+			break
+		}
+		if r != q[qi] {
+			continue
+		}
+		score++
+		if i == last+1 {
+			score += 2
+		}
+		if i == 0 || strings.ContainsRune("-_./ ", n[i-1]) {
+			score += 3
+		}
+		last = i
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	return score*4 - len(n)/4, true
+}
+
+// previewLines describes a setting for the preview pane.
+func (p *picker) previewLines(name string) []string {
+	c := p.configs[name]
+	lines := []string{"Spreadsheet: " + c.Spreadsheet}
+	if c.Template != "" {
+		var refs []string
+		for _, n := range c.cellNames() {
+			refs = append(refs, n+"="+c.Cells[n])
+		}
+		lines = append(lines, "Sheet: "+c.Sheet, "Cells: "+strings.Join(refs, ", "))
+	} else {
+		lines = append(lines, "Sheet: "+c.Sheet, "Cell:  "+c.cellLabel())
+	}
+	if v, ok := p.cache[name]; ok {
+		lines = append(lines, fmt.Sprintf("Cached: %s (%s)", c.displayValue(v.Value), v.FetchedAt.Format("2006-01-02 15:04")))
+	} else {
+		lines = append(lines, "Cached: -")
+	}
+	return lines
+}
+
+// render draws the picker: the query line, the matching names and a preview
+// of the selected setting at the bottom.
+func (p *picker) render(w io.Writer, width, height int) {
+	const previewHeight = 5
+	listHeight := height - previewHeight - 2
+	if listHeight < 1 {
+		listHeight = 1
+	}
+	if p.selected < p.offset {
+		p.offset = p.selected
+	}
+	if p.selected >= p.offset+listHeight {
+		p.offset = p.selected - listHeight + 1
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "> %s\x1b[2m  %d/%d\x1b[0m\r\n", string(p.query), len(p.matches), len(p.names))
+	for i := p.offset; i < p.offset+listHeight; i++ {
+		if i < len(p.matches) {
+			line := truncate(p.matches[i], width-2)
+			if i == p.selected {
+				fmt.Fprintf(&b, "\x1b[7m> %s\x1b[0m", line)
+			} else {
+				b.WriteString("  " + line)
+			}
+		}
+		b.WriteString("\r\n")
+	}
+	b.WriteString(strings.Repeat("─", width))
+	if len(p.matches) > 0 {
+		for _, line := range p.previewLines(p.matches[p.selected]) {
+			b.WriteString("\r\n" + truncate(strings.ReplaceAll(line, "\n", " "), width))
+		}
+	}
+	io.WriteString(w, b.String())
+}
+
+// truncate shortens s to at most width runes.
+func truncate(s string, width int) string {
+	if width < 1 {
+		return ""
+	}
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	return string(r[:width-1]) + "…"
+}
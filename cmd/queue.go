@@ -0,0 +1,449 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"google.golang.org/api/sheets/v4"
+)
+
+var (
+	queueParams    []string
+	queueDown      bool
+	queueCount     int
+	queueHeader    int
+	queueAdvance   string
+	queueClipboard string
+)
+
+// How the queue moves to the next value, see --advance.
+const (
+	advanceEnter  = "enter"
+	advanceKey    = "key"
+	advanceChange = "change"
+)
+
+// queuePoll is how often the clipboard is checked with --advance change.
+const queuePoll = 300 * time.Millisecond
+
+var queueCmd = &cobra.Command{
+	Use:   "queue <setting_name> [args...]",
+	Short: "Copy the cells of a row one at a time, for filling in forms",
+	Long: "Fetch the row starting at a setting's cell (or the column with --down) and put\n" +
+		"its values on the clipboard one after another. The current field is highlighted;\n" +
+		"n or Enter moves on, s skips the field, b goes back and q quits.\n\n" +
+		"--advance key moves on with any other key as well, and --advance change moves on\n" +
+		"by itself when the clipboard no longer holds the current value, e.g. because\n" +
+		"something else was copied. Pastes themselves cannot be observed.\n\n" +
+		"Fields are labeled with their cell, or with the cells of --header ROW.",
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeFirstSettingName,
+	Run: func(cmd *cobra.Command, args []string) {
+		configs, err := loadConfigs()
+		if err != nil {
+			log.Fatalf("Unable to load settings: %v", err)
+		}
+		settingName := args[0]
+		config, ok := configs[settingName]
+		if !ok {
+			log.Fatalf("Setting '%s' not found in config file", settingName)
+		}
+		if config.Template != "" {
+			log.Fatalf("Setting '%s' is a composite setting; queue needs a single starting cell", settingName)
+		}
+		if n := config.PositionalArgs(); len(args)-1 > n {
+			log.Fatalf("Setting '%s' takes %d argument(s), got %d", settingName, n, len(args)-1)
+		}
+		switch queueAdvance {
+		case advanceEnter, advanceKey, advanceChange:
+		default:
+			log.Fatalf("Invalid --advance %q: use enter, key or change", queueAdvance)
+		}
+		if queueDown && queueHeader > 0 {
+			log.Fatalf("--header can only be used for rows, not with --down")
+		}
+
+		params, err := parseParams(args[1:], queueParams)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if queueClipboard != "" {
+			config.Clipboard = queueClipboard
+		}
+		config, err = config.Resolve(params)
+		if err != nil {
+			log.Fatalf("Invalid setting '%s': %v", settingName, err)
+		}
+		sink, err := config.sink()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if queueAdvance == advanceChange {
+			if _, err := sink.Read(); err == errCannotRead {
+				log.Fatalf("--advance change needs a clipboard that can be read, not %s", sink.Spec())
+			}
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+			log.Fatalf("queue needs a terminal")
+		}
+
+		srv, err := newSheetsService()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		selected := map[string]Config{settingName: config}
+		saveSheetUpdates(resolveSheetIDs(srv, selected))
+		config = selected[settingName]
+
+		items, err := fetchQueue(srv, config)
+		if err != nil {
+			log.Fatalf("Unable to retrieve data from sheet: %v", err)
+		}
+		if len(items) == 0 {
+			fmt.Println("No data found.")
+			return
+		}
+
+		previous, readErr := sink.Read()
+		q := &pasteQueue{name: settingName, config: config, sink: sink, items: items}
+		if err := q.run(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		q.summary(os.Stdout)
+
+		// 最後にコピーした値も機密設定なら消しておく
+		if wait, _ := config.clearAfter(); wait > 0 && readErr == nil && q.copied != "" {
+			if err := scheduleClear(sink, q.copied, previous, wait); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: unable to schedule clearing the clipboard: %v\n", err)
+			}
+		}
+	},
+}
+
+// queueItem is one field of the queue.
+type queueItem struct {
+	Label  string
+	Value  string
+	Status queueStatus
+}
+
+type queueStatus int
+
+const (
+	queuePending queueStatus = iota
+	queueDone
+	queueSkipped
+)
+
+// fetchQueue reads the values starting at the setting's cell, along the row
+// or down the column, with the header labels if requested.
+func fetchQueue(srv *sheets.Service, c Config) ([]queueItem, error) {
+	col := columnIndex(c.XAxis)
+	rowNum, _ := strconv.Atoi(string(c.YAxis))
+
+	sheet := quoteSheet(c.Sheet) + "!"
+	ranges := []string{sheet + c.XAxis + string(c.YAxis) + ":" + string(c.YAxis)}
+	dimension := "ROWS"
+	if queueDown {
+		ranges[0] = sheet + c.XAxis + string(c.YAxis) + ":" + c.XAxis
+		dimension = "COLUMNS"
+	}
+	if queueHeader > 0 {
+		ranges = append(ranges, fmt.Sprintf("%s%s%d:%d", sheet, c.XAxis, queueHeader, queueHeader))
+	}
+
+	valueRender, dateTimeRender := c.renderOptions()
+	resp, err := srv.Spreadsheets.Values.BatchGet(spreadsheetID(c.Spreadsheet)).
+		Ranges(ranges...).
+		MajorDimension(dimension).
+		ValueRenderOption(valueRender).
+		DateTimeRenderOption(dateTimeRender).
+		Do()
+	if err != nil {
+		return nil, err
+	}
+
+	var values, headers []interface{}
+	if len(resp.ValueRanges) > 0 && len(resp.ValueRanges[0].Values) > 0 {
+		values = resp.ValueRanges[0].Values[0]
+	}
+	if len(resp.ValueRanges) > 1 && len(resp.ValueRanges[1].Values) > 0 {
+		headers = resp.ValueRanges[1].Values[0]
+	}
+	var dates []bool
+	if c.isoDates() && hasNumber(values) {
+		if dates, err = fetchQueueDates(srv, c, ranges[0]); err != nil {
+			return nil, err
+		}
+	}
+	n := len(values)
+	if queueCount > 0 {
+		n = queueCount
+	}
+
+	items := make([]queueItem, n)
+	for i := range items {
+		var v interface{} = ""
+		if i < len(values) {
+			v = values[i]
+		}
+		v, err := c.convertValue(v, i < len(dates) && dates[i])
+		if err != nil {
+			return nil, err
+		}
+		// 空のセルは変換しない (regex_extract などが失敗するため)
+		if valueText(v) != "" {
+			v, _, err = c.transform(v)
+			if err != nil {
+				return nil, fmt.Errorf("field %d: %w", i+1, err)
+			}
+		}
+		items[i].Value = valueText(v)
+
+		if queueDown {
+			items[i].Label = fmt.Sprintf("%s%d", c.XAxis, rowNum+i)
+		} else {
+			items[i].Label = fmt.Sprintf("%s%d", columnName(col+i), rowNum)
+		}
+		if i < len(headers) {
+			if h := valueText(headers[i]); h != "" {
+				items[i].Label = h
+			}
+		}
+	}
+	return items, nil
+}
+
+// fetchQueueDates reports which cells of the queue's range are formatted as
+// dates, in the order of the range.
+func fetchQueueDates(srv *sheets.Service, c Config, rng string) ([]bool, error) {
+	resp, err := srv.Spreadsheets.Get(spreadsheetID(c.Spreadsheet)).
+		Ranges(rng).
+		IncludeGridData(true).
+		Fields(dateFormatFields).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the number format of the cells: %w", err)
+	}
+	var dates []bool
+	for _, s := range resp.Sheets {
+		for _, d := range s.Data {
+			for i, row := range d.RowData {
+				if queueDown {
+					dates = append(dates, len(row.Values) > 0 && isDateCell(row.Values[0]))
+					continue
+				}
+				if i == 0 {
+					for _, cell := range row.Values {
+						dates = append(dates, isDateCell(cell))
+					}
+				}
+			}
+		}
+	}
+	return dates, nil
+}
+
+func hasNumber(values []interface{}) bool {
+	for _, v := range values {
+		if _, ok := v.(float64); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pasteQueue is the state of 'queue'.
+type pasteQueue struct {
+	name    string
+	config  Config
+	sink    clipboardSink
+	items   []queueItem
+	current int
+	// copied is the value last put on the clipboard, from field copiedAt.
+	copied   string
+	copiedAt int
+}
+
+// run shows the queue in the alternate screen until the last field is done
+// or the user quits.
+func (q *pasteQueue) run() error {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(in, state)
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan []keyEvent)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- parseKeys(buf[:n])
+		}
+	}()
+	var poll <-chan time.Time
+	if queueAdvance == advanceChange {
+		ticker := time.NewTicker(queuePoll)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	if err := q.copyCurrent(); err != nil {
+		return err
+	}
+	for q.current < len(q.items) {
+		width, height, err := term.GetSize(out)
+		if err != nil {
+			width, height = 80, 24
+		}
+		q.render(os.Stdout, width, height)
+
+		select {
+		case events, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, ev := range events {
+				if !q.handle(ev) {
+					return nil
+				}
+			}
+		case <-poll:
+			if v, err := q.sink.Read(); err == nil && v != q.copied {
+				q.move(queueDone, 1)
+			}
+		}
+		if q.current < len(q.items) && q.current != q.copiedAt {
+			if err := q.copyCurrent(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handle applies a key. It returns false when the user quits.
+func (q *pasteQueue) handle(ev keyEvent) bool {
+	switch {
+	case ev.key == keyCancel || ev.key == keyRune && ev.r == 'q':
+		return false
+	case ev.key == keyEnter || ev.key == keyDown || ev.key == keyRune && (ev.r == 'n' || ev.r == ' '):
+		q.move(queueDone, 1)
+	case ev.key == keyRune && ev.r == 's':
+		q.move(queueSkipped, 1)
+	case ev.key == keyUp || ev.key == keyRune && ev.r == 'b':
+		q.move(queuePending, -1)
+	case ev.key == keyRune && queueAdvance == advanceKey:
+		q.move(queueDone, 1)
+	}
+	return true
+}
+
+// move marks the current field and moves by delta, staying at the first
+// field when going back.
+func (q *pasteQueue) move(status queueStatus, delta int) {
+	if q.current >= len(q.items) {
+		return
+	}
+	if delta < 0 {
+		if q.current > 0 {
+			q.current--
+			q.items[q.current].Status = queuePending
+		}
+		return
+	}
+	q.items[q.current].Status = status
+	q.current += delta
+}
+
+// copyCurrent puts the current field on the clipboard.
+func (q *pasteQueue) copyCurrent() error {
+	v := q.items[q.current].Value
+	if err := q.sink.Write(v); err != nil {
+		return fmt.Errorf("unable to copy to %s: %w", q.sink.Target(), err)
+	}
+	q.copied, q.copiedAt = v, q.current
+	return nil
+}
+
+// render draws the fields around the current one.
+func (q *pasteQueue) render(w io.Writer, width, height int) {
+	labelWidth := 0
+	for _, it := range q.items {
+		labelWidth = max(labelWidth, len([]rune(it.Label)))
+	}
+	labelWidth = min(labelWidth, width/3)
+
+	listHeight := max(height-3, 1)
+	offset := 0
+	if q.current >= listHeight {
+		offset = q.current - listHeight + 1
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "%s  %d/%d\x1b[2m  n/Enter: next  s: skip  b: back  q: quit\x1b[0m\r\n",
+		q.name, min(q.current+1, len(q.items)), len(q.items))
+	b.WriteString(strings.Repeat("─", width) + "\r\n")
+	for i := offset; i < len(q.items) && i < offset+listHeight; i++ {
+		it := q.items[i]
+		mark := " "
+		switch it.Status {
+		case queueDone:
+			mark = "✓"
+		case queueSkipped:
+			mark = "-"
+		}
+		label := truncate(it.Label, labelWidth)
+		label += strings.Repeat(" ", labelWidth-len([]rune(label)))
+		value := strings.ReplaceAll(q.config.displayValue(it.Value), "\n", " ")
+		line := truncate(fmt.Sprintf("%s %s  %s", mark, label, value), width-2)
+		if i == q.current {
+			fmt.Fprintf(&b, "\x1b[7m> %s\x1b[0m\r\n", line)
+		} else {
+			b.WriteString("  " + line + "\r\n")
+		}
+	}
+	io.WriteString(w, b.String())
+}
+
+// summary prints how many fields were copied and skipped.
+func (q *pasteQueue) summary(w io.Writer) {
+	done, skipped := 0, 0
+	for _, it := range q.items {
+		switch it.Status {
+		case queueDone:
+			done++
+		case queueSkipped:
+			skipped++
+		}
+	}
+	fmt.Fprintf(w, "Queue '%s': %d of %d field(s) done, %d skipped.\n", q.name, done, len(q.items), skipped)
+}
+
+func init() {
+	queueCmd.Flags().StringArrayVarP(&queueParams, "param", "p", nil, "Fill a named placeholder (key=value, repeatable)")
+	queueCmd.Flags().BoolVar(&queueDown, "down", false, "Go down the column instead of along the row")
+	queueCmd.Flags().IntVarP(&queueCount, "count", "n", 0, "Number of fields (default: up to the last non-empty cell)")
+	queueCmd.Flags().IntVar(&queueHeader, "header", 0, "Row whose cells label the fields")
+	queueCmd.Flags().StringVar(&queueAdvance, "advance", advanceEnter, "How to move on: enter, key or change")
+	queueCmd.Flags().StringVar(&queueClipboard, "clipboard", "", "Where to copy: auto, system, primary, osc52, tmux, type, file:PATH or command:CMD")
+	queueCmd.RegisterFlagCompletionFunc("advance", cobra.FixedCompletions(
+		[]string{advanceEnter, advanceKey, advanceChange}, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.AddCommand(queueCmd)
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Render modes of a setting, see Config.Render.
+const (
+	renderFormatted   = "formatted"
+	renderUnformatted = "unformatted"
+	renderFormula     = "formula"
+)
+
+// Date/time modes of a setting, see Config.DateTime.
+const (
+	dateTimeFormatted = "formatted"
+	dateTimeSerial    = "serial"
+	dateTimeISO       = "iso"
+)
+
+// sheetsEpoch is day 0 of Google Sheets serial dates.
+var sheetsEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// validateRender checks the render settings of a setting.
+func (c Config) validateRender() error {
+	switch strings.ToLower(c.Render) {
+	case "", renderFormatted, renderUnformatted, renderFormula:
+	default:
+		return fmt.Errorf("invalid render %q: use formatted, unformatted or formula", c.Render)
+	}
+	switch strings.ToLower(c.DateTime) {
+	case "", dateTimeFormatted, dateTimeSerial, dateTimeISO:
+	default:
+		return fmt.Errorf("invalid date_time %q: use formatted, serial or iso", c.DateTime)
+	}
+	if _, err := c.location(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// renderOptions maps the render settings to the API's ValueRenderOption and
+// DateTimeRenderOption. Converting dates to ISO-8601 needs serial numbers, so
+// "iso" implies unformatted values unless formulas were asked for.
+func (c Config) renderOptions() (valueRender, dateTimeRender string) {
+	render := strings.ToLower(c.Render)
+	dateTime := strings.ToLower(c.DateTime)
+	if dateTime == dateTimeISO && render != renderFormula {
+		render = renderUnformatted
+	}
+
+	switch render {
+	case renderUnformatted:
+		valueRender = "UNFORMATTED_VALUE"
+	case renderFormula:
+		valueRender = "FORMULA"
+	default:
+		valueRender = "FORMATTED_VALUE"
+	}
+	switch dateTime {
+	case dateTimeFormatted:
+		dateTimeRender = "FORMATTED_STRING"
+	default:
+		dateTimeRender = "SERIAL_NUMBER"
+	}
+	return valueRender, dateTimeRender
+}
+
+// location returns the time zone used for ISO-8601 dates, the local one by
+// default.
+func (c Config) location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+	}
+	return loc, nil
+}
+
+// convertValue converts serial dates to ISO-8601 strings when the setting
+// asks for it and the cell is formatted as a date or time (see
+// fetchDateCells). Other values are returned unchanged.
+func (c Config) convertValue(v interface{}, isDate bool) (interface{}, error) {
+	serial, ok := v.(float64)
+	if !ok || !isDate || !c.isoDates() {
+		return v, nil
+	}
+	loc, err := c.location()
+	if err != nil {
+		return nil, err
+	}
+	return serialToISO(serial, loc), nil
+}
+
+// isoDates reports whether the setting converts dates to ISO-8601.
+func (c Config) isoDates() bool {
+	return strings.ToLower(c.DateTime) == dateTimeISO
+}
+
+// needsDateCells reports whether values read for the setting include numbers
+// that may be dates, so that the cells' formats must be read to tell.
+func (c Config) needsDateCells(vrs []*sheets.ValueRange) bool {
+	if !c.isoDates() {
+		return false
+	}
+	for _, vr := range vrs {
+		if v, _ := firstValue(vr); v != nil {
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dateFormatFields is the field mask for the number formats read by
+// fetchDateCells.
+const dateFormatFields = "sheets(properties(title),data(startRow,startColumn," +
+	"rowData(values(effectiveFormat(numberFormat(type))))))"
+
+// fetchDateCells reports, in the order of the setting's ranges, which cells
+// are formatted as a date, time or date-time. Unformatted values do not tell
+// a date from a number, so this is what decides whether a serial number is
+// converted.
+func fetchDateCells(srv *sheets.Service, c Config) ([]bool, error) {
+	resp, err := srv.Spreadsheets.Get(spreadsheetID(c.Spreadsheet)).
+		Ranges(c.ranges()...).
+		IncludeGridData(true).
+		Fields(dateFormatFields).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the number format of the cell: %w", err)
+	}
+
+	type cellKey struct {
+		sheet    string
+		row, col int64
+	}
+	dates := make(map[cellKey]bool)
+	for _, s := range resp.Sheets {
+		if s.Properties == nil {
+			continue
+		}
+		for _, d := range s.Data {
+			if len(d.RowData) > 0 && len(d.RowData[0].Values) > 0 && isDateCell(d.RowData[0].Values[0]) {
+				dates[cellKey{s.Properties.Title, d.StartRow, d.StartColumn}] = true
+			}
+		}
+	}
+
+	targets := c.targets()
+	result := make([]bool, len(targets))
+	for i, t := range targets {
+		col, row := splitCell(t.Cell)
+		result[i] = dates[cellKey{t.Sheet, int64(row - 1), int64(columnIndex(col) - 1)}]
+	}
+	return result, nil
+}
+
+// isDateCell reports whether a cell is formatted as a date, time or
+// date-time.
+func isDateCell(cell *sheets.CellData) bool {
+	if cell == nil || cell.EffectiveFormat == nil || cell.EffectiveFormat.NumberFormat == nil {
+		return false
+	}
+	switch cell.EffectiveFormat.NumberFormat.Type {
+	case "DATE", "TIME", "DATE_TIME":
+		return true
+	}
+	return false
+}
+
+// serialToISO converts a serial date (days since 1899-12-30, with the time as
+// the fraction) to ISO-8601 in loc. Whole days are written as plain dates.
+func serialToISO(serial float64, loc *time.Location) string {
+	days := math.Floor(serial)
+	secs := int(math.Round((serial - days) * 24 * 60 * 60))
+	// 日付と時刻を分けて組み立て、夏時間の切り替えでずれないようにする
+	d := sheetsEpoch.AddDate(0, 0, int(days))
+	t := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, secs, 0, loc)
+	if secs == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
+
+// valueText formats a fetched value for the clipboard and the terminal.
+// Numbers are written in full rather than in exponent form.
+func valueText(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
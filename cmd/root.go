@@ -11,12 +11,46 @@ var (
 )
 
 // Config represents a single setting for a spreadsheet.
-
+// Any field may contain placeholders such as "{{.Arg1}}" or "{{.month}}",
+// which are filled from the arguments given to 'get'.
+//
+// SheetID is the stable ID (gid) of the sheet. When set, the sheet's current
+// title is looked up by ID so that renaming the tab does not break the setting.
+//
+// Render selects formatted (default), unformatted or formula values, and
+// DateTime how dates are returned: formatted, serial or iso (ISO-8601 in
+// Timezone, the local time zone by default).
+//
+// A composite setting declares named Cells instead of XAxis/YAxis and renders
+// them through Template, e.g. "Invoice {{.invoice}}: {{formatNumber .amount}} JPY".
 type Config struct {
-	Spreadsheet string `yaml:"spreadsheet"`
-	Sheet       string `yaml:"sheet"`
-	XAxis       string `yaml:"x_axis"`
-	YAxis       int    `yaml:"y_axis"`
+	Spreadsheet string            `yaml:"spreadsheet" json:"spreadsheet"`
+	Sheet       string            `yaml:"sheet,omitempty" json:"sheet,omitempty"`
+	SheetID     *int64            `yaml:"sheet_id,omitempty" json:"sheet_id,omitempty"`
+	XAxis       string            `yaml:"x_axis,omitempty" json:"x_axis,omitempty"`
+	YAxis       Row               `yaml:"y_axis,omitempty" json:"y_axis,omitempty"`
+	Cells       map[string]string `yaml:"cells,omitempty" json:"cells,omitempty"`
+	Template    string            `yaml:"template,omitempty" json:"template,omitempty"`
+	Render      string            `yaml:"render,omitempty" json:"render,omitempty"`
+	DateTime    string            `yaml:"date_time,omitempty" json:"date_time,omitempty"`
+	Timezone    string            `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	Transforms  []Transform       `yaml:"transforms,omitempty" json:"transforms,omitempty"`
+	Sensitive   bool              `yaml:"sensitive,omitempty" json:"sensitive,omitempty"`
+	ClearAfter  string            `yaml:"clear_after,omitempty" json:"clear_after,omitempty"`
+	Clipboard   string            `yaml:"clipboard,omitempty" json:"clipboard,omitempty"`
+	Description string            `yaml:"description,omitempty" json:"description,omitempty"`
+	Tags        []string          `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Group       string            `yaml:"group,omitempty" json:"group,omitempty"`
+}
+
+// HasTag reports whether the setting is tagged with tag.
+func (c Config) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
 var rootCmd = &cobra.Command{
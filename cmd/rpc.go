@@ -0,0 +1,542 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/sheets/v4"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	// rpcSheetsError is returned when the Sheets API call fails.
+	rpcSheetsError = -32000
+)
+
+// Polling interval of watch subscriptions.
+const (
+	rpcWatchDefault = 30 * time.Second
+	rpcWatchMin     = 5 * time.Second
+)
+
+var rpcCmd = &cobra.Command{
+	Use:   "rpc",
+	Short: "Speak JSON-RPC 2.0 over stdin/stdout for editor integrations",
+	Long: "Read JSON-RPC 2.0 requests from stdin, one per line, and write responses and\n" +
+		"notifications to stdout, one per line. Methods:\n\n" +
+		"  settings.list                             all settings\n" +
+		"  value.get       {name, args, params}      a setting's value\n" +
+		"  range.get       {name | spreadsheet, range, args, params}\n" +
+		"                                            the values of a range (the setting's\n" +
+		"                                            sheet if range has none)\n" +
+		"  auth.status                               credentials, token and daemon state\n" +
+		"  watch.subscribe {name, args, params, interval}\n" +
+		"                                            send watch.changed notifications when\n" +
+		"                                            the value changes (interval in seconds)\n" +
+		"  watch.unsubscribe {subscription}\n\n" +
+		"Anything else cell-clip prints goes to stderr. The command exits when stdin closes.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// 他の出力でプロトコルが壊れないよう、標準出力は応答専用にする
+		out := os.Stdout
+		os.Stdout = os.Stderr
+		log.SetOutput(os.Stderr)
+
+		s := newRPCServer(out)
+		if err := s.serve(os.Stdin); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// rpcServer handles the requests of one 'rpc' session.
+type rpcServer struct {
+	mu  sync.Mutex
+	out io.Writer
+
+	// srv is created on first use; failures are not cached, so that a
+	// request after 'cell-clip auth login' succeeds.
+	srvMu sync.Mutex
+	srv   *sheets.Service
+
+	// ctx is the parent of every watch and is canceled when the session
+	// ends; closing is set under watchMu at the same time, so that no watch
+	// starts after that.
+	ctx       context.Context
+	stop      context.CancelFunc
+	watchMu   sync.Mutex
+	closing   bool
+	watches   map[int]context.CancelFunc
+	nextWatch int
+
+	wg sync.WaitGroup
+}
+
+func newRPCServer(out io.Writer) *rpcServer {
+	ctx, stop := context.WithCancel(context.Background())
+	return &rpcServer{out: out, ctx: ctx, stop: stop, watches: make(map[int]context.CancelFunc)}
+}
+
+// serve reads requests until r is exhausted. Requests are handled
+// concurrently, so that a slow fetch does not hold up the others; batches are
+// answered as a whole.
+func (s *rpcServer) serve(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '[' {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(line, &batch); err != nil || len(batch) == 0 {
+				s.write(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+					Error: &rpcError{Code: rpcInvalidRequest, Message: "invalid batch"}})
+				continue
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				var responses []rpcResponse
+				for _, raw := range batch {
+					if resp, ok := s.handle(raw); ok {
+						responses = append(responses, resp)
+					}
+				}
+				if len(responses) > 0 {
+					s.write(responses)
+				}
+			}()
+			continue
+		}
+
+		raw := append(json.RawMessage(nil), line...)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if resp, ok := s.handle(raw); ok {
+				s.write(resp)
+			}
+		}()
+	}
+
+	s.watchMu.Lock()
+	s.closing = true
+	s.stop()
+	s.watchMu.Unlock()
+	s.wg.Wait()
+	return scanner.Err()
+}
+
+// handle runs one request. ok is false for notifications, which get no
+// response.
+func (s *rpcServer) handle(raw json.RawMessage) (resp rpcResponse, ok bool) {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &rpcError{Code: rpcParseError, Message: fmt.Sprintf("parse error: %v", err)}}, true
+	}
+	resp = rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	if resp.ID == nil {
+		resp.ID = json.RawMessage("null")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &rpcError{Code: rpcInvalidRequest, Message: "invalid request"}
+		return resp, true
+	}
+
+	result, err := s.call(req.Method, req.Params)
+	if err != nil {
+		var rerr *rpcError
+		if !errors.As(err, &rerr) {
+			rerr = &rpcError{Code: rpcInternalError, Message: err.Error()}
+		}
+		resp.Error = rerr
+	} else {
+		resp.Result = result
+	}
+	return resp, req.ID != nil
+}
+
+func (s *rpcServer) call(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "settings.list":
+		return s.listSettings()
+	case "value.get":
+		var p rpcValueParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.getValue(p)
+	case "range.get":
+		var p rpcRangeParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.getRange(p)
+	case "auth.status":
+		return rpcAuthStatus(), nil
+	case "watch.subscribe":
+		var p rpcWatchParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.subscribe(p)
+	case "watch.unsubscribe":
+		var p struct {
+			Subscription int `json:"subscription"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.unsubscribe(p.Subscription)
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method %q not found", method)}
+}
+
+// decodeParams decodes by-name params. Missing params are left zero.
+func decodeParams(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+	}
+	return nil
+}
+
+// write sends one message on its own line.
+func (s *rpcServer) write(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Unable to encode response: %v", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.out.Write(append(data, '\n'))
+}
+
+// sheets returns the Sheets client, created on first use. It refuses to
+// start the interactive OAuth flow, which would need the terminal.
+func (s *rpcServer) sheets() (*sheets.Service, error) {
+	s.srvMu.Lock()
+	defer s.srvMu.Unlock()
+	if s.srv != nil {
+		return s.srv, nil
+	}
+	if st := rpcAuthStatus(); !st.Token && !st.Daemon {
+		return nil, &rpcError{Code: rpcSheetsError, Message: "not authenticated: run 'cell-clip auth login'"}
+	}
+	srv, err := newSheetsService()
+	if err != nil {
+		return nil, &rpcError{Code: rpcSheetsError, Message: err.Error()}
+	}
+	s.srv = srv
+	return srv, nil
+}
+
+func (s *rpcServer) listSettings() (interface{}, error) {
+	configs, err := loadConfigs()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load settings: %w", err)
+	}
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]listEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, listEntry{Name: name, Config: configs[name]})
+	}
+	return entries, nil
+}
+
+// rpcValueParams selects a setting and fills its placeholders.
+type rpcValueParams struct {
+	Name   string            `json:"name"`
+	Args   []string          `json:"args"`
+	Params map[string]string `json:"params"`
+}
+
+// resolve looks up the setting and follows renamed sheets.
+func (s *rpcServer) resolve(p rpcValueParams) (Config, error) {
+	if p.Name == "" {
+		return Config{}, &rpcError{Code: rpcInvalidParams, Message: "name is required"}
+	}
+	configs, err := loadConfigs()
+	if err != nil {
+		return Config{}, fmt.Errorf("unable to load settings: %w", err)
+	}
+	c, err := resolveSetting(configs, p.Name, p.Args, p.Params)
+	if err != nil {
+		return Config{}, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	srv, err := s.sheets()
+	if err != nil {
+		return Config{}, err
+	}
+	selected := map[string]Config{p.Name: c}
+	updates := resolveSheetIDs(srv, selected)
+	s.mu.Lock()
+	saveSheetUpdates(updates)
+	s.mu.Unlock()
+	return selected[p.Name], nil
+}
+
+func (s *rpcServer) getValue(p rpcValueParams) (interface{}, error) {
+	c, err := s.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	return s.fetch(p.Name, c)
+}
+
+// fetch reads a resolved setting as a getResult.
+func (s *rpcServer) fetch(name string, c Config) (getResult, error) {
+	srv, err := s.sheets()
+	if err != nil {
+		return getResult{}, err
+	}
+	updates := make(map[string]sheetUpdate)
+	value, found, err := fetchFollowingRenames(srv, name, map[string]Config{name: c}, updates)
+	s.mu.Lock()
+	saveSheetUpdates(updates)
+	s.mu.Unlock()
+	if err != nil {
+		return getResult{}, &rpcError{Code: rpcSheetsError, Message: err.Error()}
+	}
+	return getResult{Name: name, Value: value, Text: valueText(value), Found: found}, nil
+}
+
+// rpcRangeParams selects a range, either of a setting's spreadsheet or of
+// any spreadsheet.
+type rpcRangeParams struct {
+	rpcValueParams
+	Spreadsheet string `json:"spreadsheet"`
+	Range       string `json:"range"`
+}
+
+// rpcRange is a range and its values, row by row.
+type rpcRange struct {
+	Range  string          `json:"range"`
+	Values [][]interface{} `json:"values"`
+}
+
+func (s *rpcServer) getRange(p rpcRangeParams) (interface{}, error) {
+	c := Config{Spreadsheet: p.Spreadsheet}
+	var ranges []string
+	switch {
+	case p.Name != "":
+		var err error
+		if c, err = s.resolve(p.rpcValueParams); err != nil {
+			return nil, err
+		}
+		ranges = c.ranges()
+		if p.Range != "" {
+			ranges = []string{p.Range}
+			if !strings.Contains(p.Range, "!") {
+				ranges[0] = quoteSheet(c.Sheet) + "!" + p.Range
+			}
+		}
+	case p.Spreadsheet != "" && p.Range != "":
+		ranges = []string{p.Range}
+	default:
+		return nil, &rpcError{Code: rpcInvalidParams, Message: "name, or spreadsheet and range, are required"}
+	}
+
+	srv, err := s.sheets()
+	if err != nil {
+		return nil, err
+	}
+	valueRender, dateTimeRender := c.renderOptions()
+	resp, err := srv.Spreadsheets.Values.BatchGet(spreadsheetID(c.Spreadsheet)).
+		Ranges(ranges...).
+		ValueRenderOption(valueRender).
+		DateTimeRenderOption(dateTimeRender).
+		Do()
+	if err != nil {
+		return nil, &rpcError{Code: rpcSheetsError, Message: err.Error()}
+	}
+	result := make([]rpcRange, 0, len(resp.ValueRanges))
+	for _, vr := range resp.ValueRanges {
+		values := vr.Values
+		if values == nil {
+			values = [][]interface{}{}
+		}
+		result = append(result, rpcRange{Range: vr.Range, Values: values})
+	}
+	return result, nil
+}
+
+// rpcAuth is the result of auth.status.
+type rpcAuth struct {
+	Credentials bool       `json:"credentials"`
+	Token       bool       `json:"token"`
+	Expiry      *time.Time `json:"expiry,omitempty"`
+	Refreshable bool       `json:"refreshable"`
+	Daemon      bool       `json:"daemon"`
+}
+
+// rpcAuthStatus reports what is needed to reach the Sheets API, without
+// contacting Google.
+func rpcAuthStatus() rpcAuth {
+	var st rpcAuth
+	if _, err := loadCredentials(); err == nil {
+		st.Credentials = true
+	}
+	if dir, err := configDir(); err == nil {
+		if data, err := os.ReadFile(filepath.Join(dir, "token.json")); err == nil {
+			var tok oauth2.Token
+			if json.Unmarshal(data, &tok) == nil {
+				st.Token = true
+				st.Refreshable = tok.RefreshToken != ""
+				if !tok.Expiry.IsZero() {
+					st.Expiry = &tok.Expiry
+				}
+			}
+		}
+	}
+	if path, err := daemonSocketPath(); err == nil {
+		_, err := daemonStatus(path)
+		st.Daemon = err == nil && os.Getenv(noDaemonEnv) == ""
+	}
+	return st
+}
+
+// rpcWatchParams subscribes to a setting's value.
+type rpcWatchParams struct {
+	rpcValueParams
+	// Interval is the polling interval in seconds.
+	Interval float64 `json:"interval"`
+}
+
+// rpcChange is the params of a watch.changed notification.
+type rpcChange struct {
+	Subscription int         `json:"subscription"`
+	Name         string      `json:"name"`
+	Value        interface{} `json:"value"`
+	Found        bool        `json:"found"`
+	Error        string      `json:"error,omitempty"`
+}
+
+func (s *rpcServer) subscribe(p rpcWatchParams) (interface{}, error) {
+	c, err := s.resolve(p.rpcValueParams)
+	if err != nil {
+		return nil, err
+	}
+	interval := rpcWatchDefault
+	if p.Interval > 0 {
+		interval = max(time.Duration(p.Interval*float64(time.Second)), rpcWatchMin)
+	}
+
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if s.closing {
+		return nil, &rpcError{Code: rpcInvalidRequest, Message: "the session is closing"}
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.nextWatch++
+	id := s.nextWatch
+	s.watches[id] = cancel
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.watch(ctx, id, p.Name, c, interval)
+	}()
+	return map[string]int{"subscription": id}, nil
+}
+
+// watch polls a setting and notifies the client of its first value and of
+// every change, including errors.
+func (s *rpcServer) watch(ctx context.Context, id int, name string, c Config, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := ""
+	first := true
+	for {
+		change := rpcChange{Subscription: id, Name: name}
+		r, err := s.fetch(name, c)
+		if err != nil {
+			change.Error = err.Error()
+		} else {
+			change.Value, change.Found = r.Value, r.Found
+		}
+		key := fmt.Sprintf("%s\x00%t\x00%s", r.Text, r.Found, change.Error)
+		if first || key != last {
+			s.write(rpcNotification{JSONRPC: "2.0", Method: "watch.changed", Params: change})
+			first, last = false, key
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *rpcServer) unsubscribe(id int) (interface{}, error) {
+	s.watchMu.Lock()
+	cancel, ok := s.watches[id]
+	delete(s.watches, id)
+	s.watchMu.Unlock()
+	if !ok {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("subscription %d not found", id)}
+	}
+	cancel()
+	return map[string]bool{"ok": true}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(rpcCmd)
+}
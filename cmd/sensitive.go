@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// defaultClearAfter is how long a sensitive value stays on the clipboard
+// unless clear_after says otherwise.
+const defaultClearAfter = 30 * time.Second
+
+// maskedValue replaces sensitive values in terminal output.
+const maskedValue = "********"
+
+// clearRequest is what 'get' hands to the background clear-clipboard process
+// on its stdin. Only a hash of the copied value is passed, so that the value
+// itself does not linger in another process.
+type clearRequest struct {
+	Hash     string `json:"hash"`
+	Previous string `json:"previous"`
+}
+
+// clearAfter returns how long the copied value stays on the clipboard, or 0
+// if it is never cleared.
+func (c Config) clearAfter() (time.Duration, error) {
+	if c.ClearAfter == "" {
+		if c.Sensitive {
+			return defaultClearAfter, nil
+		}
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.ClearAfter)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid clear_after %q: use a duration such as 30s, or 0 to keep the value", c.ClearAfter)
+	}
+	return d, nil
+}
+
+// displayValue returns text as it may be shown in the terminal.
+func (c Config) displayValue(text string) string {
+	if c.Sensitive {
+		return maskedValue
+	}
+	return text
+}
+
+// scheduleClear starts a detached 'clear-clipboard' process that restores
+// previous after the given time if the sink still holds value.
+func scheduleClear(sink clipboardSink, value, previous string, after time.Duration) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, "clear-clipboard", "--after", after.String(), "--clipboard", sink.Spec())
+	detach(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	err = json.NewEncoder(stdin).Encode(clearRequest{Hash: hashValue(value), Previous: previous})
+	stdin.Close()
+	if err != nil {
+		cmd.Process.Kill()
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// hashValue returns the hex SHA-256 of s.
+func hashValue(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
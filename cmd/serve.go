@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+)
+
+var (
+	serveAddr        string
+	serveRotateToken bool
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve settings and values over a localhost JSON API",
+	Long: "Serve a JSON API on localhost for other tools:\n\n" +
+		"  GET /settings                 all settings\n" +
+		"  GET /settings/{name}/value    fetch a value (?arg=...&key=value for placeholders)\n" +
+		"  PUT /settings/{name}/value    write {\"value\": ...} to a plain setting's cell\n\n" +
+		"Every request needs an 'Authorization: Bearer TOKEN' header. The token is\n" +
+		"generated on first use and stored in ~/.cell-clip/serve-token; --rotate-token\n" +
+		"replaces it. Writing values needs 'cell-clip auth login --write'.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := checkLoopback(serveAddr); err != nil {
+			log.Fatalf("%v", err)
+		}
+		token, tokenPath, err := loadServeToken(serveRotateToken)
+		if err != nil {
+			log.Fatalf("Unable to load API token: %v", err)
+		}
+		srv, err := newSheetsService()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		api := &apiServer{srv: srv, token: token}
+		httpSrv := &http.Server{Addr: serveAddr, Handler: api.routes(), ReadHeaderTimeout: 10 * time.Second}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			log.Printf("Shutting down...")
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			httpSrv.Shutdown(ctx)
+		}()
+
+		log.Printf("Serving on http://%s (token in %s)", serveAddr, tokenPath)
+		if err := httpSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+// checkLoopback refuses addresses other than localhost, since the API hands
+// out spreadsheet contents.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("invalid address %q: serve only listens on localhost", addr)
+}
+
+// loadServeToken returns the API token, creating it if it does not exist or
+// rotate is set.
+func loadServeToken(rotate bool) (token, path string, err error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", "", err
+	}
+	path = filepath.Join(dir, "serve-token")
+	if !rotate {
+		data, err := os.ReadFile(path)
+		if err == nil && len(strings.TrimSpace(string(data))) > 0 {
+			return strings.TrimSpace(string(data)), path, nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return "", "", err
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(b)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", "", err
+	}
+	return token, path, nil
+}
+
+// apiServer handles the requests of 'serve'.
+type apiServer struct {
+	srv   *sheets.Service
+	token string
+	// mu serializes writes to the settings file.
+	mu sync.Mutex
+}
+
+func (a *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /settings", a.listSettings)
+	mux.HandleFunc("GET /settings/{name}/value", a.getValue)
+	mux.HandleFunc("PUT /settings/{name}/value", a.putValue)
+	return logRequests(a.authorize(mux))
+}
+
+// authorize rejects requests without the bearer token.
+func (a *apiServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logRequests logs the method, path, status and duration of each request.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		log.Printf("%s %s %d %s", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+func (a *apiServer) listSettings(w http.ResponseWriter, r *http.Request) {
+	configs, err := loadConfigs()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("unable to load settings: %v", err))
+		return
+	}
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]listEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, listEntry{Name: name, Config: configs[name]})
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (a *apiServer) getValue(w http.ResponseWriter, r *http.Request) {
+	name, c, ok := a.resolve(w, r)
+	if !ok {
+		return
+	}
+	updates := make(map[string]sheetUpdate)
+	value, found, err := fetchFollowingRenames(a.srv, name, map[string]Config{name: c}, updates)
+	a.mu.Lock()
+	saveSheetUpdates(updates)
+	a.mu.Unlock()
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, getResult{Name: name, Value: value, Found: found})
+}
+
+// valueUpdate is the body of a PUT request. The value is written as is
+// unless UserEntered is set, in which case Sheets parses it as if typed,
+// including formulas.
+type valueUpdate struct {
+	Value       interface{} `json:"value"`
+	UserEntered bool        `json:"user_entered,omitempty"`
+}
+
+func (a *apiServer) putValue(w http.ResponseWriter, r *http.Request) {
+	var body valueUpdate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %v", err))
+		return
+	}
+	if body.Value == nil {
+		writeError(w, http.StatusBadRequest, `body must be {"value": ...}`)
+		return
+	}
+	name, c, ok := a.resolve(w, r)
+	if !ok {
+		return
+	}
+	if c.Template != "" {
+		writeError(w, http.StatusBadRequest, "composite settings cannot be written")
+		return
+	}
+
+	// 既定では RAW で書き、数式を入れられないようにする
+	input := "RAW"
+	if body.UserEntered {
+		input = "USER_ENTERED"
+	}
+	resp, err := a.srv.Spreadsheets.Values.Update(spreadsheetID(c.Spreadsheet), c.ranges()[0],
+		&sheets.ValueRange{Values: [][]interface{}{{body.Value}}}).
+		ValueInputOption(input).
+		Do()
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"name": name, "updated_range": resp.UpdatedRange})
+}
+
+// resolve looks up the setting of a request and fills its placeholders from
+// the query: arg for positional ones, any other key for named ones.
+func (a *apiServer) resolve(w http.ResponseWriter, r *http.Request) (string, Config, bool) {
+	name := r.PathValue("name")
+	configs, err := loadConfigs()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("unable to load settings: %v", err))
+		return "", Config{}, false
+	}
+	query := r.URL.Query()
+	named := make(map[string]string)
+	for key, values := range query {
+		if key != "arg" && len(values) > 0 {
+			named[key] = values[len(values)-1]
+		}
+	}
+	c, err := resolveSetting(configs, name, query["arg"], named)
+	if errors.Is(err, errSettingNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return "", Config{}, false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return "", Config{}, false
+	}
+
+	selected := map[string]Config{name: c}
+	updates := resolveSheetIDs(a.srv, selected)
+	a.mu.Lock()
+	saveSheetUpdates(updates)
+	a.mu.Unlock()
+	return name, selected[name], true
+}
+
+// writeAPIError reports a Sheets API error with a matching status.
+func writeAPIError(w http.ResponseWriter, err error) {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch {
+		case gerr.Code == http.StatusForbidden && strings.Contains(strings.ToLower(gerr.Message), "scope"):
+			writeError(w, http.StatusForbidden, "the stored token cannot write to spreadsheets: run 'cell-clip auth login --write'")
+			return
+		case gerr.Code == http.StatusNotFound || gerr.Code == http.StatusForbidden:
+			writeError(w, gerr.Code, describeAccessError(err))
+			return
+		case gerr.Code == http.StatusBadRequest:
+			writeError(w, http.StatusBadRequest, gerr.Message)
+			return
+		}
+	}
+	writeError(w, http.StatusBadGateway, fmt.Sprintf("unable to reach spreadsheet: %v", err))
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "127.0.0.1:8765", "Address to listen on (localhost only)")
+	serveCmd.Flags().BoolVar(&serveRotateToken, "rotate-token", false, "Generate a new API token")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// sheetUpdate is a change to the stored sheet of a setting: a tab that was
+// renamed.
+type sheetUpdate struct {
+	Title   string
+	SheetID int64
+}
+
+// resolveSheetIDs replaces the sheet title of every setting that has a sheet
+// ID with the tab's current title. Titles come from the metadata cache; a
+// spreadsheet's metadata is fetched, once, only when the cache does not know
+// the sheet ID. A cached title may be stale, see fetchFollowingRenames.
+// Renamed tabs are reported on stderr and returned as updates.
+func resolveSheetIDs(srv *sheets.Service, configs map[string]Config) map[string]sheetUpdate {
+	return resolveSheetTitles(srv, configs, false)
+}
+
+// resolveSheetTitles resolves sheet IDs as resolveSheetIDs does, reading
+// fresh metadata instead of the cache when refresh is set.
+func resolveSheetTitles(srv *sheets.Service, configs map[string]Config, refresh bool) map[string]sheetUpdate {
+	updates := make(map[string]sheetUpdate)
+	var cache map[string]*spreadsheetMeta
+	if !refresh {
+		cache = loadMetaCache()
+	}
+	// metas holds the metadata fetched during this call.
+	metas := make(map[string]*spreadsheetMeta)
+	for name, c := range configs {
+		if c.SheetID == nil {
+			continue
+		}
+		id := spreadsheetID(c.Spreadsheet)
+		meta, ok := metas[id]
+		if cached := cache[id]; !ok && cached != nil && cached.sheetByID(*c.SheetID) != nil {
+			meta, ok = cached, true
+		}
+		if !ok {
+			var err error
+			meta, err = refreshSpreadsheetMeta(srv, id)
+			if err != nil {
+				// 取得に失敗した場合は保存済みの名前のまま読みにいく
+				meta = nil
+			}
+			metas[id] = meta
+		}
+		if meta == nil {
+			continue
+		}
+
+		s := meta.sheetByID(*c.SheetID)
+		if s == nil {
+			fmt.Fprintf(os.Stderr, "Warning: sheet with ID %d of setting '%s' no longer exists, using '%s'\n", *c.SheetID, name, c.Sheet)
+			continue
+		}
+		if s.Title != c.Sheet {
+			fmt.Fprintf(os.Stderr, "Sheet '%s' of setting '%s' was renamed to '%s'; updating the setting\n", c.Sheet, name, s.Title)
+			c.Sheet = s.Title
+			configs[name] = c
+			updates[name] = sheetUpdate{Title: s.Title, SheetID: s.SheetID}
+		}
+	}
+	return updates
+}
+
+// refreshRenamed reads fresh metadata for the named settings that follow a
+// sheet ID, in case their cached title is stale, and returns the names
+// whose title changed. Their updates are added to updates.
+func refreshRenamed(srv *sheets.Service, configs map[string]Config, names []string, updates map[string]sheetUpdate) []string {
+	failed := make(map[string]Config)
+	for _, name := range names {
+		if c, ok := configs[name]; ok && c.SheetID != nil {
+			failed[name] = c
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	var renamed []string
+	for name, u := range resolveSheetTitles(srv, failed, true) {
+		configs[name] = failed[name]
+		updates[name] = u
+		renamed = append(renamed, name)
+	}
+	return renamed
+}
+
+// fetchFollowingRenames fetches a setting, and if that fails, retries once
+// with the tab's current title when the setting follows a renamed sheet.
+func fetchFollowingRenames(srv *sheets.Service, name string, configs map[string]Config, updates map[string]sheetUpdate) (interface{}, bool, error) {
+	value, found, err := fetchSetting(srv, configs[name])
+	if err != nil && len(refreshRenamed(srv, configs, []string{name}, updates)) > 0 {
+		return fetchSetting(srv, configs[name])
+	}
+	return value, found, err
+}
+
+// lookupSheetID returns the sheet ID of a tab, to be recorded in a setting.
+// It returns nil without an error when the sheet is not set or either is a
+// placeholder.
+func lookupSheetID(spreadsheet, sheet string) (*int64, error) {
+	if sheet == "" || strings.Contains(spreadsheet, "{{") || strings.Contains(sheet, "{{") {
+		return nil, nil
+	}
+	srv, err := newSheetsService()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := refreshSpreadsheetMeta(srv, spreadsheetID(spreadsheet))
+	if err != nil {
+		return nil, fmt.Errorf("%s", describeAccessError(err))
+	}
+	s := findSheet(meta, sheet)
+	if s == nil {
+		return nil, fmt.Errorf("sheet %q not found", sheet)
+	}
+	id := s.SheetID
+	return &id, nil
+}
+
+// saveSheetUpdates writes sheet updates back to the config file. Settings
+// whose sheet is a placeholder are left alone, and so are included settings,
+// which are resolved again on every run rather than copied into config.yml.
+// Errors are reported but not fatal, since the value has already been
+// fetched.
+func saveSheetUpdates(updates map[string]sheetUpdate) {
+	if len(updates) == 0 {
+		return
+	}
+	layers, err := loadConfigLayers()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to update settings: %v\n", err)
+		return
+	}
+	configs := layers.merged()
+
+	changed := false
+	for name, u := range updates {
+		c, ok := configs[name]
+		if !ok || !layers.isLocal(name) || strings.Contains(c.Sheet, "{{") {
+			continue
+		}
+		id := u.SheetID
+		c.Sheet, c.SheetID = u.Title, &id
+		configs[name] = c
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if _, err := saveConfigs(configs); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to update settings: %v\n", err)
+	}
+}
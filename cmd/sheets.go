@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+var spreadsheetIDRe = regexp.MustCompile(`/d/([^/?#]+)`) // capture characters after /d/ up to '/', '?' or '#'
+
+// sheetLink is what a Google Sheets URL points to.
+type sheetLink struct {
+	ID     string
+	GID    int64
+	HasGID bool
+	// Range is the A1 range from "range=", without a sheet name.
+	Range string
+}
+
+// newSheetsService builds an authenticated Sheets API client. When the
+// daemon is running, requests go through it instead.
+func newSheetsService() (*sheets.Service, error) {
+	if srv, ok := daemonSheetsService(); ok {
+		return srv, nil
+	}
+
+	oauthManager, err := NewOAuthManager()
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize OAuth manager: %w", err)
+	}
+
+	client, err := oauthManager.GetAuthenticatedClient()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get authenticated client: %w", err)
+	}
+
+	srv, err := sheets.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve Sheets client: %w", err)
+	}
+	return srv, nil
+}
+
+// parseSheetURL parses the forms a spreadsheet can be given in:
+//
+//	https://docs.google.com/spreadsheets/d/ID/edit#gid=123&range=B7
+//	https://docs.google.com/spreadsheets/u/0/d/ID/edit?gid=123
+//	https://docs.google.com/open?id=ID
+//	ID
+//
+// The gid and range are read from both the query and the fragment.
+func parseSheetURL(s string) (sheetLink, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return sheetLink{}, fmt.Errorf("spreadsheet is empty")
+	}
+	if !strings.Contains(s, "/") && !strings.Contains(s, "?") {
+		return sheetLink{ID: s}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return sheetLink{}, fmt.Errorf("invalid spreadsheet URL: %w", err)
+	}
+
+	var link sheetLink
+	if m := spreadsheetIDRe.FindStringSubmatch(u.Path); len(m) > 1 {
+		link.ID = m[1]
+	} else if id := u.Query().Get("id"); id != "" {
+		link.ID = id
+	} else if key := u.Query().Get("key"); key != "" {
+		link.ID = key
+	} else {
+		return sheetLink{}, fmt.Errorf("no spreadsheet ID found in %q", s)
+	}
+
+	// The fragment looks like a query string: gid=123&range=B7
+	fragment, _ := url.ParseQuery(u.Fragment)
+	for _, values := range []url.Values{u.Query(), fragment} {
+		if gid := values.Get("gid"); gid != "" {
+			n, err := strconv.ParseInt(gid, 10, 64)
+			if err != nil {
+				return sheetLink{}, fmt.Errorf("invalid gid %q", gid)
+			}
+			link.GID, link.HasGID = n, true
+		}
+		if r := values.Get("range"); r != "" {
+			link.Range = r
+		}
+	}
+	return link, nil
+}
+
+// spreadsheetID extracts the spreadsheet ID if a full URL is provided.
+func spreadsheetID(spreadsheet string) string {
+	link, err := parseSheetURL(spreadsheet)
+	if err != nil {
+		return spreadsheet
+	}
+	return link.ID
+}
+
+// quoteSheet quotes a sheet name for use in A1 notation.
+func quoteSheet(sheet string) string {
+	return "'" + strings.ReplaceAll(sheet, "'", "''") + "'"
+}
+
+// cellLabel describes the cell a setting reads, for listings.
+func (c Config) cellLabel() string {
+	if c.Template != "" {
+		return fmt.Sprintf("template (%d cells)", len(c.Cells))
+	}
+	return fmt.Sprintf("%s%s", c.XAxis, c.YAxis)
+}
+
+// columnIndex converts column letters such as "A" or "AB" to a 1-based index.
+func columnIndex(col string) int {
+	n := 0
+	for _, r := range strings.ToUpper(col) {
+		if r < 'A' || r > 'Z' {
+			return 0
+		}
+		n = n*26 + int(r-'A'+1)
+	}
+	return n
+}
+
+// columnName converts a 1-based column index to letters.
+func columnName(n int) string {
+	var b []byte
+	for n > 0 {
+		n--
+		b = append([]byte{byte('A' + n%26)}, b...)
+		n /= 26
+	}
+	return string(b)
+}
+
+// splitCell splits a cell such as "B12" into its column and row.
+func splitCell(cell string) (col string, row int) {
+	i := strings.IndexFunc(cell, func(r rune) bool { return r >= '0' && r <= '9' })
+	if i < 0 {
+		return cell, 0
+	}
+	row, _ = strconv.Atoi(cell[i:])
+	return cell[:i], row
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import "testing"
+
+func TestParseSheetURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    sheetLink
+		wantErr bool
+	}{
+		{
+			name: "edit link with gid and range in fragment",
+			in:   "https://docs.google.com/spreadsheets/d/ID123/edit#gid=123&range=B7",
+			want: sheetLink{ID: "ID123", GID: 123, HasGID: true, Range: "B7"},
+		},
+		{
+			name: "account path with gid in query",
+			in:   "https://docs.google.com/spreadsheets/u/0/d/ID123/edit?gid=5",
+			want: sheetLink{ID: "ID123", GID: 5, HasGID: true},
+		},
+		{
+			name: "open link",
+			in:   "https://docs.google.com/open?id=ID123",
+			want: sheetLink{ID: "ID123"},
+		},
+		{
+			name: "bare ID",
+			in:   "  ID123  ",
+			want: sheetLink{ID: "ID123"},
+		},
+		{
+			name: "sharing link with gid in fragment",
+			in:   "https://docs.google.com/spreadsheets/d/ID123/edit?usp=sharing#gid=1",
+			want: sheetLink{ID: "ID123", GID: 1, HasGID: true},
+		},
+		{
+			name: "range link",
+			in:   "https://docs.google.com/spreadsheets/d/ID123/edit#gid=0&range=A1:C3",
+			want: sheetLink{ID: "ID123", GID: 0, HasGID: true, Range: "A1:C3"},
+		},
+		{
+			name:    "invalid gid",
+			in:      "https://docs.google.com/spreadsheets/d/ID123/edit#gid=abc",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			in:      "   ",
+			wantErr: true,
+		},
+		{
+			name:    "URL without ID",
+			in:      "https://docs.google.com/spreadsheets/",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSheetURL(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseSheetURL(%q) = %+v, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSheetURL(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseSheetURL(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpreadsheetID(t *testing.T) {
+	for in, want := range map[string]string{
+		"https://docs.google.com/spreadsheets/d/ID123/edit#gid=0": "ID123",
+		"ID123": "ID123",
+		"":      "",
+	} {
+		if got := spreadsheetID(in); got != want {
+			t.Errorf("spreadsheetID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
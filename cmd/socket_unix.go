@@ -0,0 +1,16 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenSocket listens on a Unix socket created with mode 0600, so that no
+// other user can connect between its creation and a chmod.
+func listenSocket(path string) (net.Listener, error) {
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
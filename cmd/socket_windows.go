@@ -0,0 +1,19 @@
+//go:build windows
+
+package cmd
+
+import (
+	"net"
+	"os"
+)
+
+// listenSocket listens on a Unix socket. Windows has no umask; access is
+// limited by the directory's ACL.
+func listenSocket(path string) (net.Listener, error) {
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	os.Chmod(path, 0600)
+	return ln, nil
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+var cellRe = regexp.MustCompile(`^[A-Za-z]{1,3}[0-9]+$`)
+
+// templateFuncs are the helper functions available in composite templates.
+var templateFuncs = template.FuncMap{
+	"trim":         strings.TrimSpace,
+	"upper":        strings.ToUpper,
+	"lower":        strings.ToLower,
+	"replace":      func(old, repl, s string) string { return strings.ReplaceAll(s, old, repl) },
+	"default":      func(def, s string) string { return orDefault(s, def) },
+	"formatNumber": formatNumber,
+}
+
+func orDefault(s, def string) string {
+	if strings.TrimSpace(s) == "" {
+		return def
+	}
+	return s
+}
+
+// formatNumber inserts thousands separators into a number, keeping its
+// decimal part. Values that are not numbers are returned unchanged.
+func formatNumber(s string) string {
+	v := strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	sign := ""
+	if strings.HasPrefix(v, "-") || strings.HasPrefix(v, "+") {
+		sign, v = v[:1], v[1:]
+	}
+	intPart, frac, hasFrac := strings.Cut(v, ".")
+	if intPart == "" || strings.Trim(intPart, "0123456789") != "" ||
+		(hasFrac && strings.Trim(frac, "0123456789") != "") {
+		return s
+	}
+
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	if hasFrac {
+		b.WriteString("." + frac)
+	}
+	return sign + b.String()
+}
+
+// splitRef splits a cell reference such as "B2" or "'Other sheet'!B2" into
+// its sheet and cell parts. The sheet is empty when not given.
+func splitRef(ref string) (sheet, cell string) {
+	i := strings.LastIndex(ref, "!")
+	if i < 0 {
+		return "", strings.TrimSpace(ref)
+	}
+	sheet = strings.TrimSpace(ref[:i])
+	if len(sheet) >= 2 && strings.HasPrefix(sheet, "'") && strings.HasSuffix(sheet, "'") {
+		sheet = strings.ReplaceAll(sheet[1:len(sheet)-1], "''", "'")
+	}
+	return sheet, strings.TrimSpace(ref[i+1:])
+}
+
+// validateCells checks the cell references of a composite setting.
+func (c Config) validateCells() error {
+	if len(c.Cells) == 0 {
+		return fmt.Errorf("template setting has no cells")
+	}
+	if _, err := template.New("value").Funcs(templateFuncs).Parse(c.Template); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	for name, ref := range c.Cells {
+		sheet, cell := splitRef(ref)
+		if sheet == "" && c.Sheet == "" {
+			return fmt.Errorf("cell %q (%s) has no sheet and the setting has no default sheet", name, ref)
+		}
+		if !cellRe.MatchString(cell) {
+			return fmt.Errorf("invalid cell %q for %q: must look like B2", cell, name)
+		}
+	}
+	return nil
+}
+
+// cellNames returns the names of the cells of a composite setting in the
+// order used by ranges.
+func (c Config) cellNames() []string {
+	names := make([]string, 0, len(c.Cells))
+	for name := range c.Cells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cellTarget is one cell read by a setting.
+type cellTarget struct {
+	Sheet string
+	Cell  string
+}
+
+// targets returns the cells a setting reads, in the order used by ranges.
+func (c Config) targets() []cellTarget {
+	if c.Template == "" {
+		return []cellTarget{{Sheet: c.Sheet, Cell: fmt.Sprintf("%s%s", c.XAxis, c.YAxis)}}
+	}
+	var targets []cellTarget
+	for _, name := range c.cellNames() {
+		sheet, cell := splitRef(c.Cells[name])
+		if sheet == "" {
+			sheet = c.Sheet
+		}
+		targets = append(targets, cellTarget{Sheet: sheet, Cell: cell})
+	}
+	return targets
+}
+
+// ranges returns the A1 ranges a setting reads.
+func (c Config) ranges() []string {
+	var ranges []string
+	for _, t := range c.targets() {
+		ranges = append(ranges, quoteSheet(t.Sheet)+"!"+t.Cell)
+	}
+	return ranges
+}
+
+// firstValue returns the top-left value of a value range, as typed by the
+// API: a string, a float64 for unformatted numbers, or a bool.
+func firstValue(vr *sheets.ValueRange) (interface{}, bool) {
+	if vr == nil || len(vr.Values) == 0 || len(vr.Values[0]) == 0 {
+		return "", false
+	}
+	return vr.Values[0][0], true
+}
+
+// settingValue builds the value of a setting from the value ranges returned
+// for its ranges, in the same order. dates tells which of them are dates,
+// see fetchDateCells; it may be nil when no conversion is needed. Plain
+// settings keep the type of their cell; composite settings always yield a
+// string. found is false when a plain setting's cell is empty.
+func (c Config) settingValue(vrs []*sheets.ValueRange, dates []bool) (value interface{}, found bool, err error) {
+	isDate := func(i int) bool { return i < len(dates) && dates[i] }
+	if c.Template == "" {
+		if len(vrs) == 0 {
+			return "", false, nil
+		}
+		value, found = firstValue(vrs[0])
+		if !found {
+			return "", false, nil
+		}
+		value, err = c.convertValue(value, isDate(0))
+		if err != nil {
+			return "", false, err
+		}
+		return c.transform(value)
+	}
+
+	data := make(map[string]string, len(c.Cells))
+	for i, name := range c.cellNames() {
+		if i >= len(vrs) {
+			continue
+		}
+		v, _ := firstValue(vrs[i])
+		v, err := c.convertValue(v, isDate(i))
+		if err != nil {
+			return "", false, err
+		}
+		data[name] = valueText(v)
+	}
+	tmpl, err := template.New("value").Funcs(templateFuncs).Option("missingkey=error").Parse(c.Template)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", false, fmt.Errorf("unable to render template: %w", err)
+	}
+	return c.transform(buf.String())
+}
+
+// transform runs a fetched value through the setting's transforms. Values
+// without transforms keep their type.
+func (c Config) transform(value interface{}) (interface{}, bool, error) {
+	if len(c.Transforms) == 0 {
+		return value, true, nil
+	}
+	text, err := applyTransforms(valueText(value), c.Transforms)
+	if err != nil {
+		return "", false, err
+	}
+	return text, true, nil
+}
+
+// fetchSetting reads all cells of a setting with a single BatchGet call.
+func fetchSetting(srv *sheets.Service, c Config) (interface{}, bool, error) {
+	valueRender, dateTimeRender := c.renderOptions()
+	resp, err := srv.Spreadsheets.Values.BatchGet(spreadsheetID(c.Spreadsheet)).
+		Ranges(c.ranges()...).
+		ValueRenderOption(valueRender).
+		DateTimeRenderOption(dateTimeRender).
+		Do()
+	if err != nil {
+		return "", false, err
+	}
+	var dates []bool
+	if c.needsDateCells(resp.ValueRanges) {
+		if dates, err = fetchDateCells(srv, c); err != nil {
+			return "", false, err
+		}
+	}
+	return c.settingValue(resp.ValueRanges, dates)
+}
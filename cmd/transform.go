@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Transform is one step of a setting's value pipeline. Which fields are used
+// depends on Type:
+//
+//	trim                                 strip surrounding whitespace
+//	regex_extract  pattern, group        keep a match (group 1 if the pattern has one)
+//	regex_replace  pattern, replace      replace every match ($1 expands groups)
+//	case           value                 upper, lower or title
+//	prefix/suffix  value                 prepend or append text
+//	number         decimals, separator   reformat a number ("1,234.5" -> "1234.50")
+//	split          separator, index/join pick one part, or join the parts with join
+//	json_path      path                  extract from JSON stored in the cell (a.b[0].c)
+type Transform struct {
+	Type      string `yaml:"type" json:"type"`
+	Pattern   string `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	Replace   string `yaml:"replace,omitempty" json:"replace,omitempty"`
+	Group     *int   `yaml:"group,omitempty" json:"group,omitempty"`
+	Value     string `yaml:"value,omitempty" json:"value,omitempty"`
+	Decimals  *int   `yaml:"decimals,omitempty" json:"decimals,omitempty"`
+	Separator string `yaml:"separator,omitempty" json:"separator,omitempty"`
+	Index     *int   `yaml:"index,omitempty" json:"index,omitempty"`
+	Join      string `yaml:"join,omitempty" json:"join,omitempty"`
+	Path      string `yaml:"path,omitempty" json:"path,omitempty"`
+}
+
+// validateTransforms checks that every transform is well-formed.
+func validateTransforms(ts []Transform) error {
+	for i, t := range ts {
+		if _, err := t.apply(""); err != nil && !isValueError(err) {
+			return fmt.Errorf("transform %d (%s): %w", i+1, t.Type, err)
+		}
+	}
+	return nil
+}
+
+// valueError is a transform error caused by the value rather than by the
+// transform's definition.
+type valueError struct{ error }
+
+func isValueError(err error) bool {
+	_, ok := err.(valueError)
+	return ok
+}
+
+// applyTransforms runs value through the transforms in order.
+func applyTransforms(value string, ts []Transform) (string, error) {
+	for i, t := range ts {
+		var err error
+		value, err = t.apply(value)
+		if err != nil {
+			return "", fmt.Errorf("transform %d (%s): %w", i+1, t.Type, err)
+		}
+	}
+	return value, nil
+}
+
+// apply runs one transform.
+func (t Transform) apply(s string) (string, error) {
+	switch t.Type {
+	case "trim":
+		return strings.TrimSpace(s), nil
+	case "regex_extract":
+		re, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern: %w", err)
+		}
+		group := 0
+		if re.NumSubexp() > 0 {
+			group = 1
+		}
+		if t.Group != nil {
+			group = *t.Group
+		}
+		if group < 0 || group > re.NumSubexp() {
+			return "", fmt.Errorf("pattern has no group %d", group)
+		}
+		m := re.FindStringSubmatch(s)
+		if m == nil {
+			return "", valueError{fmt.Errorf("pattern %q does not match %q", t.Pattern, s)}
+		}
+		return m[group], nil
+	case "regex_replace":
+		re, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern: %w", err)
+		}
+		return re.ReplaceAllString(s, t.Replace), nil
+	case "case":
+		switch t.Value {
+		case "upper":
+			return strings.ToUpper(s), nil
+		case "lower":
+			return strings.ToLower(s), nil
+		case "title":
+			return titleCase(s), nil
+		}
+		return "", fmt.Errorf("invalid case %q: use upper, lower or title", t.Value)
+	case "prefix":
+		return t.Value + s, nil
+	case "suffix":
+		return s + t.Value, nil
+	case "number":
+		return t.formatNumber(s)
+	case "split":
+		if t.Separator == "" {
+			return "", fmt.Errorf("separator is required")
+		}
+		parts := strings.Split(s, t.Separator)
+		if t.Index != nil {
+			i := *t.Index
+			if i < 0 {
+				i += len(parts)
+			}
+			if i < 0 || i >= len(parts) {
+				return "", valueError{fmt.Errorf("index %d out of range for %d part(s)", *t.Index, len(parts))}
+			}
+			return parts[i], nil
+		}
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		return strings.Join(parts, t.Join), nil
+	case "json_path":
+		keys, err := parseJSONPath(t.Path)
+		if err != nil {
+			return "", err
+		}
+		return extractJSON(s, keys)
+	}
+	return "", fmt.Errorf("unknown transform type %q", t.Type)
+}
+
+// titleCase upper-cases the first letter of every word.
+func titleCase(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsSpace(prev) {
+			return unicode.ToUpper(r)
+		}
+		return r
+	}, s)
+}
+
+// formatNumber parses a number written with any thousands separators and
+// writes it with the configured decimals and thousands separator.
+func (t Transform) formatNumber(s string) (string, error) {
+	clean := strings.Map(func(r rune) rune {
+		if r == ',' || r == '_' || unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+	if clean == "" && s == "" {
+		return "", nil
+	}
+	f, err := strconv.ParseFloat(clean, 64)
+	if err != nil {
+		return "", valueError{fmt.Errorf("%q is not a number", s)}
+	}
+
+	decimals := -1
+	if t.Decimals != nil {
+		decimals = *t.Decimals
+		f = math.Round(f*math.Pow10(decimals)) / math.Pow10(decimals)
+	}
+	if f == 0 {
+		// -0.001 を丸めた -0 を "-0.00" と書かない
+		f = 0
+	}
+	out := strconv.FormatFloat(f, 'f', decimals, 64)
+	if t.Separator == "" {
+		return out, nil
+	}
+
+	sign := ""
+	if strings.HasPrefix(out, "-") {
+		sign, out = "-", out[1:]
+	}
+	intPart, frac, hasFrac := strings.Cut(out, ".")
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(t.Separator)
+		}
+		b.WriteRune(r)
+	}
+	if hasFrac {
+		b.WriteString("." + frac)
+	}
+	return sign + b.String(), nil
+}
+
+// parseJSONPath splits a path such as "$.items[0].name" or "items.0.name"
+// into its keys.
+func parseJSONPath(path string) ([]string, error) {
+	p := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if p == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	p = strings.NewReplacer("[", ".", "]", "").Replace(p)
+	keys := strings.Split(p, ".")
+	for _, k := range keys {
+		if k == "" {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+	}
+	return keys, nil
+}
+
+// extractJSON walks a JSON document along keys. Strings are returned as is,
+// anything else as JSON.
+func extractJSON(s string, keys []string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return "", valueError{fmt.Errorf("value is not JSON: %w", err)}
+	}
+	for _, k := range keys {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			next, ok := node[k]
+			if !ok {
+				return "", valueError{fmt.Errorf("key %q not found", k)}
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", valueError{fmt.Errorf("index %q out of range", k)}
+			}
+			v = node[i]
+		default:
+			return "", valueError{fmt.Errorf("cannot look up %q in a %T", k, v)}
+		}
+	}
+	if str, ok := v.(string); ok {
+		return str, nil
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
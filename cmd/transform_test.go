@@ -0,0 +1,111 @@
+package cmd
+
+import "testing"
+
+func intPtr(i int) *int { return &i }
+
+func TestTransformApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		t       Transform
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "trim", t: Transform{Type: "trim"}, in: "  a b \n", want: "a b"},
+
+		{name: "regex_extract whole match", t: Transform{Type: "regex_extract", Pattern: `\d+`}, in: "No. 123-45", want: "123"},
+		{name: "regex_extract default group", t: Transform{Type: "regex_extract", Pattern: `(\d+)-(\d+)`}, in: "No. 123-45", want: "123"},
+		{name: "regex_extract explicit group", t: Transform{Type: "regex_extract", Pattern: `(\d+)-(\d+)`, Group: intPtr(2)}, in: "No. 123-45", want: "45"},
+		{name: "regex_extract group 0", t: Transform{Type: "regex_extract", Pattern: `(\d+)-(\d+)`, Group: intPtr(0)}, in: "No. 123-45", want: "123-45"},
+		{name: "regex_extract no match", t: Transform{Type: "regex_extract", Pattern: `\d+`}, in: "none", wantErr: true},
+
+		{name: "regex_replace", t: Transform{Type: "regex_replace", Pattern: `(\w+)@(\w+)`, Replace: "$2:$1"}, in: "a@b c@d", want: "b:a d:c"},
+
+		{name: "case upper", t: Transform{Type: "case", Value: "upper"}, in: "abc Déf", want: "ABC DÉF"},
+		{name: "case lower", t: Transform{Type: "case", Value: "lower"}, in: "ABC Déf", want: "abc déf"},
+		{name: "case title", t: Transform{Type: "case", Value: "title"}, in: "hello  wide\tworld", want: "Hello  Wide\tWorld"},
+
+		{name: "prefix", t: Transform{Type: "prefix", Value: "#"}, in: "12", want: "#12"},
+		{name: "suffix", t: Transform{Type: "suffix", Value: " JPY"}, in: "12", want: "12 JPY"},
+
+		{name: "number as is", t: Transform{Type: "number"}, in: "1,234.5", want: "1234.5"},
+		{name: "number decimals", t: Transform{Type: "number", Decimals: intPtr(2)}, in: "1,234.5", want: "1234.50"},
+		{name: "number rounds", t: Transform{Type: "number", Decimals: intPtr(0)}, in: "2.5", want: "3"},
+		{name: "number separator", t: Transform{Type: "number", Separator: ","}, in: "1234567", want: "1,234,567"},
+		{name: "number separator and decimals", t: Transform{Type: "number", Decimals: intPtr(1), Separator: " "}, in: "1234567.89", want: "1 234 567.9"},
+		{name: "number negative", t: Transform{Type: "number", Decimals: intPtr(2), Separator: ","}, in: "-1234.5", want: "-1,234.50"},
+		{name: "number negative rounds to zero", t: Transform{Type: "number", Decimals: intPtr(2)}, in: "-0.001", want: "0.00"},
+		{name: "number short negative", t: Transform{Type: "number", Separator: ","}, in: "-123", want: "-123"},
+		{name: "number empty", t: Transform{Type: "number", Decimals: intPtr(2)}, in: "", want: ""},
+		{name: "number not a number", t: Transform{Type: "number"}, in: "abc", wantErr: true},
+
+		{name: "split index", t: Transform{Type: "split", Separator: "/", Index: intPtr(1)}, in: "a/b/c", want: "b"},
+		{name: "split negative index", t: Transform{Type: "split", Separator: "/", Index: intPtr(-1)}, in: "a/b/c", want: "c"},
+		{name: "split index out of range", t: Transform{Type: "split", Separator: "/", Index: intPtr(3)}, in: "a/b/c", wantErr: true},
+		{name: "split join", t: Transform{Type: "split", Separator: ",", Join: "\n"}, in: "a, b ,c", want: "a\nb\nc"},
+
+		{name: "json_path nested keys", t: Transform{Type: "json_path", Path: "$.a.b"}, in: `{"a":{"b":"x"}}`, want: "x"},
+		{name: "json_path array index", t: Transform{Type: "json_path", Path: "items[1].name"}, in: `{"items":[{"name":"a"},{"name":"b"}]}`, want: "b"},
+		{name: "json_path dotted index", t: Transform{Type: "json_path", Path: "items.0"}, in: `{"items":[1,2]}`, want: "1"},
+		{name: "json_path non-string", t: Transform{Type: "json_path", Path: "a"}, in: `{"a":{"b":[1,true]}}`, want: `{"b":[1,true]}`},
+		{name: "json_path missing key", t: Transform{Type: "json_path", Path: "a.c"}, in: `{"a":{"b":"x"}}`, wantErr: true},
+		{name: "json_path non-JSON", t: Transform{Type: "json_path", Path: "a"}, in: "not json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.t.apply(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("apply(%q) = %q, want error", tt.in, got)
+				}
+				if !isValueError(err) {
+					t.Errorf("apply(%q): %v is not a value error", tt.in, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("apply(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTransforms(t *testing.T) {
+	tests := []struct {
+		name    string
+		ts      []Transform
+		wantErr bool
+	}{
+		// 値によっては失敗するが、定義としては正しいもの
+		{name: "regex_extract", ts: []Transform{{Type: "regex_extract", Pattern: `\d+`}}},
+		{name: "number", ts: []Transform{{Type: "number", Decimals: intPtr(2)}}},
+		{name: "split index", ts: []Transform{{Type: "split", Separator: "/", Index: intPtr(2)}}},
+		{name: "json_path", ts: []Transform{{Type: "json_path", Path: "a.b"}}},
+		{name: "pipeline", ts: []Transform{{Type: "trim"}, {Type: "case", Value: "upper"}, {Type: "prefix", Value: "x"}}},
+
+		{name: "unknown type", ts: []Transform{{Type: "reverse"}}, wantErr: true},
+		{name: "invalid pattern", ts: []Transform{{Type: "regex_extract", Pattern: "("}}, wantErr: true},
+		{name: "missing group", ts: []Transform{{Type: "regex_extract", Pattern: `(\d+)`, Group: intPtr(2)}}, wantErr: true},
+		{name: "invalid replace pattern", ts: []Transform{{Type: "regex_replace", Pattern: "["}}, wantErr: true},
+		{name: "invalid case", ts: []Transform{{Type: "case", Value: "camel"}}, wantErr: true},
+		{name: "split without separator", ts: []Transform{{Type: "split"}}, wantErr: true},
+		{name: "json_path without path", ts: []Transform{{Type: "json_path"}}, wantErr: true},
+		{name: "invalid json_path", ts: []Transform{{Type: "json_path", Path: "a..b"}}, wantErr: true},
+		{name: "bad second step", ts: []Transform{{Type: "trim"}, {Type: "case"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTransforms(tt.ts)
+			if tt.wantErr && err == nil {
+				t.Errorf("validateTransforms() = nil, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateTransforms(): %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/api/googleapi"
+)
+
+// validation is the outcome of checking one setting.
+type validation struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+const (
+	statusOK   = "ok"
+	statusFail = "FAIL"
+	statusSkip = "skip"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [setting_name...]",
+	Short: "Check settings against the live spreadsheets",
+	Long: "Check that every setting (or the given ones) points to an accessible spreadsheet,\n" +
+		"an existing sheet and a cell inside the sheet's grid. Each spreadsheet is read once.\n" +
+		"Settings that take positional arguments are skipped.\n\n" +
+		"Exits with a non-zero status when any setting fails.",
+	ValidArgsFunction: completeSettingNames,
+	Run: func(cmd *cobra.Command, args []string) {
+		configs, err := loadConfigs()
+		if err != nil {
+			log.Fatalf("Unable to load settings: %v", err)
+		}
+
+		names := args
+		if len(names) == 0 {
+			for name := range configs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		if len(names) == 0 {
+			fmt.Println("No settings found.")
+			return
+		}
+
+		results := make([]validation, len(names))
+		groups := make(map[string][]int)
+		var order []string
+		resolved := make(map[string]Config)
+		for i, name := range names {
+			results[i].Name = name
+			c, ok := configs[name]
+			if !ok {
+				results[i].Status, results[i].Detail = statusFail, "setting not found in config file"
+				continue
+			}
+			if n := c.PositionalArgs(); n > 0 {
+				results[i].Status, results[i].Detail = statusSkip, fmt.Sprintf("takes %d argument(s)", n)
+				continue
+			}
+			c, err := c.Resolve(nil)
+			if err != nil {
+				results[i].Status, results[i].Detail = statusFail, err.Error()
+				continue
+			}
+			resolved[name] = c
+			id := spreadsheetID(c.Spreadsheet)
+			if _, ok := groups[id]; !ok {
+				order = append(order, id)
+			}
+			groups[id] = append(groups[id], i)
+		}
+
+		if len(order) > 0 {
+			srv, err := newSheetsService()
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			for _, id := range order {
+				meta, err := fetchSpreadsheetMeta(srv, id)
+				for _, i := range groups[id] {
+					if err != nil {
+						results[i].Status, results[i].Detail = statusFail, describeAccessError(err)
+						continue
+					}
+					results[i].Status, results[i].Detail = checkSetting(resolved[names[i]], meta)
+				}
+			}
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSTATUS\tDETAIL")
+		failed := 0
+		for _, r := range results {
+			if r.Status == statusFail {
+				failed++
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, r.Status, r.Detail)
+		}
+		tw.Flush()
+
+		if failed > 0 {
+			fmt.Printf("\n%d of %d setting(s) failed.\n", failed, len(results))
+			os.Exit(1)
+		}
+	},
+}
+
+// describeAccessError explains why a spreadsheet could not be read.
+func describeAccessError(err error) string {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch gerr.Code {
+		case http.StatusNotFound:
+			return "spreadsheet not found: check the URL or ID"
+		case http.StatusForbidden:
+			return "no access to spreadsheet: share it with the authenticated account"
+		}
+	}
+	return fmt.Sprintf("unable to read spreadsheet: %v", err)
+}
+
+// checkSetting checks every cell of a setting against the spreadsheet's
+// metadata. A sheet with a stored sheet ID is looked up by that ID.
+func checkSetting(c Config, meta *spreadsheetMeta) (status, detail string) {
+	if c.SheetID != nil {
+		s := meta.sheetByID(*c.SheetID)
+		if s == nil {
+			return statusFail, fmt.Sprintf("sheet with ID %d no longer exists", *c.SheetID)
+		}
+		if s.Title != c.Sheet {
+			detail = fmt.Sprintf("sheet %q was renamed to %q; 'get' will update the setting", c.Sheet, s.Title)
+			c.Sheet = s.Title
+		}
+	}
+	for _, t := range c.targets() {
+		sheet := findSheet(meta, t.Sheet)
+		if sheet == nil {
+			detail := fmt.Sprintf("sheet %q not found", t.Sheet)
+			if s := closestString(t.Sheet, meta.sheetTitles()); s != "" {
+				detail += fmt.Sprintf(" (did you mean %q?)", s)
+			}
+			return statusFail, detail
+		}
+
+		col, row := splitCell(t.Cell)
+		ci := columnIndex(col)
+		if int64(ci) > sheet.Columns || int64(row) > sheet.Rows {
+			return statusFail, fmt.Sprintf("cell %s is outside sheet %q (last cell is %s%d)",
+				t.Cell, sheet.Title, columnName(int(sheet.Columns)), sheet.Rows)
+		}
+	}
+	return statusOK, detail
+}
+
+// findSheet returns the tab with the given title.
+func findSheet(meta *spreadsheetMeta, title string) *sheetMeta {
+	for i := range meta.Sheets {
+		if meta.Sheets[i].Title == title {
+			return &meta.Sheets[i]
+		}
+	}
+	return nil
+}
+
+// closestString returns the candidate closest to s, ignoring case, or "" if
+// none is reasonably close.
+func closestString(s string, candidates []string) string {
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		d := levenshtein(strings.ToLower(s), strings.ToLower(c))
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	// 半分以上違う場合は候補として出さない
+	if bestDist < 0 || bestDist > (len([]rune(s))+1)/2 {
+		return ""
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
@@ -7,6 +7,7 @@ require (
 	github.com/pkg/browser v0.0.0-20240102092130-5ac0b6a4141c
 	github.com/spf13/cobra v1.10.1
 	golang.org/x/oauth2 v0.32.0
+	golang.org/x/term v0.35.0
 	google.golang.org/api v0.252.0
 	gopkg.in/yaml.v2 v2.4.0
 )